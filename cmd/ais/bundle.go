@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/Zuo-Peng/ai-session-search/internal/bundle"
+	"github.com/Zuo-Peng/ai-session-search/internal/config"
+	"github.com/Zuo-Peng/ai-session-search/internal/index"
+	"github.com/Zuo-Peng/ai-session-search/internal/search"
+	"github.com/spf13/cobra"
+)
+
+func exportBundleCmd() *cobra.Command {
+	var source, since, until, model, branch, remote, host string
+
+	cmd := &cobra.Command{
+		Use:   "export-bundle <file>",
+		Short: "Write indexed sessions to a bundle for another machine",
+		Long: `Writes the sessions matching the filters, with their subagents, to a compressed
+bundle that 'ais import-bundle' merges into another machine's index.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Load()
+			if err != nil {
+				return err
+			}
+			if host == "" {
+				host = cfg.Host
+			}
+
+			db, err := index.OpenDB(cfg.DBPath)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			autoIndex(db, cfg)
+
+			results, err := search.ListAll(cmd.Context(), db, search.Options{
+				Source: source,
+				Since:  since,
+				Until:  until,
+				Model:  model,
+				Branch: branch,
+				Remote: remote,
+			})
+			if err != nil {
+				return err
+			}
+			// subagents go with their parent, whatever the filters say of them
+			var keys []string
+			for _, r := range results {
+				keys = append(keys, r.SessionKey)
+				subagents, err := db.GetSubagents(r.SessionKey)
+				if err != nil {
+					return fmt.Errorf("get subagents: %w", err)
+				}
+				for _, sa := range subagents {
+					keys = append(keys, sa.SessionKey)
+				}
+			}
+
+			f, err := os.Create(args[0])
+			if err != nil {
+				return err
+			}
+			n, err := bundle.Export(db, f, keys, host)
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				os.Remove(args[0])
+				return fmt.Errorf("export: %w", err)
+			}
+			fmt.Fprintf(os.Stderr, "Exported %d sessions from %s to %s\n", n, host, args[0])
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&source, "source", "", "Filter by source ("+sourceNames()+")")
+	cmd.Flags().StringVar(&since, "since", "", "Only sessions updated since a date or age (2026-03-01, 3d, 2w, yesterday, last monday)")
+	cmd.Flags().StringVar(&until, "until", "", "Only sessions updated until a date or age, through the end of a day")
+	cmd.Flags().StringVar(&model, "model", "", "Filter by model name (substring, e.g. opus)")
+	cmd.Flags().StringVar(&branch, "branch", "", "Filter by git branch")
+	cmd.Flags().StringVar(&remote, "remote", "", "Filter by git remote URL (any clone of the same repo)")
+	cmd.Flags().StringVar(&host, "host", "", "Host name for sessions indexed before hosts were recorded (default: the configured host)")
+
+	return cmd
+}
+
+func importBundleCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "import-bundle <file>...",
+		Short: "Merge sessions from bundles into the index",
+		Long: `Merges bundles written by 'ais export-bundle' into the index. Imported sessions
+are tagged with the host they came from. A session already indexed with the same
+content is skipped, and one indexed from a local log file is never replaced.`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Load()
+			if err != nil {
+				return err
+			}
+
+			db, err := index.OpenDB(cfg.DBPath)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			release, err := lockIndex(db)
+			if err != nil {
+				return err
+			}
+			defer release()
+
+			for _, path := range args {
+				f, err := os.Open(path)
+				if err != nil {
+					return err
+				}
+				h, stats, err := bundle.Import(db, f, cfg.Host)
+				f.Close()
+				if err != nil {
+					return fmt.Errorf("%s: %w", path, err)
+				}
+				fmt.Fprintf(os.Stderr, "Imported %s (host %s): %s\n", path, h.Host, stats)
+			}
+			return nil
+		},
+	}
+}
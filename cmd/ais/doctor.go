@@ -3,15 +3,19 @@ package main
 import (
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/Zuo-Peng/ai-session-search/internal/config"
 	"github.com/Zuo-Peng/ai-session-search/internal/index"
 	"github.com/Zuo-Peng/ai-session-search/internal/scan"
+	"github.com/Zuo-Peng/ai-session-search/internal/source"
 	"github.com/spf13/cobra"
 )
 
 func doctorCmd() *cobra.Command {
-	return &cobra.Command{
+	var dryRun bool
+
+	cmd := &cobra.Command{
 		Use:   "doctor",
 		Short: "Self-check: verify roots, DB, FTS5, and show stats",
 		RunE: func(cmd *cobra.Command, args []string) error {
@@ -22,25 +26,31 @@ func doctorCmd() *cobra.Command {
 
 			// check roots
 			fmt.Println("=== Roots ===")
-			checkDir("Claude", cfg.ClaudeRoot)
-			checkDir("Codex", cfg.CodexRoot)
+			fmt.Printf("  Host: %s\n", cfg.Host)
+			for i, hc := range cfg.HostConfigs() {
+				for _, src := range source.All() {
+					for _, root := range src.Roots(hc) {
+						if i > 0 && root == "" {
+							continue
+						}
+						checkDir(strings.TrimSuffix(rootLabel(src, hc, i), ":"), root)
+					}
+				}
+			}
 
 			// scan file counts
 			fmt.Println("\n=== File Scan ===")
-			files, err := scan.ScanRoots(cfg.ClaudeRoot, cfg.CodexRoot)
+			files, err := scan.ScanRoots(cfg)
 			if err != nil {
 				fmt.Printf("  scan error: %v\n", err)
 			} else {
-				claudeCount, codexCount := 0, 0
+				counts := make(map[string]int)
 				for _, f := range files {
-					if f.Source == "claude" {
-						claudeCount++
-					} else {
-						codexCount++
-					}
+					counts[f.Source]++
+				}
+				for _, name := range source.Names() {
+					fmt.Printf("  %-7s files: %d\n", name, counts[name])
 				}
-				fmt.Printf("  Claude JSONL files: %d\n", claudeCount)
-				fmt.Printf("  Codex  JSONL files: %d\n", codexCount)
 			}
 
 			// check DB
@@ -51,11 +61,48 @@ func doctorCmd() *cobra.Command {
 				return nil
 			}
 
+			// a killed indexer leaves its pid in the lock file, but not the lock;
+			// the next one to take the lock overwrites it
+			switch pid, held, err := index.LockStatus(cfg.DBPath); {
+			case err != nil:
+				fmt.Printf("  Index lock: %v\n", err)
+			case held:
+				fmt.Printf("  Index lock: held by pid %d (indexing)\n", pid)
+			case pid != 0:
+				fmt.Printf("  Index lock: free (stale pid %d from an indexer that was killed)\n", pid)
+			default:
+				fmt.Println("  Index lock: free")
+			}
+
+			// check schema before opening, which applies pending migrations
+			version, pending, err := index.PendingMigrations(cfg.DBPath)
+			if err != nil {
+				return fmt.Errorf("check migrations: %w", err)
+			}
+			fmt.Printf("  Migration: %d\n", version)
+			if len(pending) == 0 {
+				fmt.Println("  Schema: up to date")
+			} else {
+				fmt.Printf("  Schema: %d pending migration(s)\n", len(pending))
+				for _, m := range pending {
+					fmt.Printf("    %d  %s\n", m.Version, m.Name)
+				}
+			}
+			if dryRun {
+				if len(pending) > 0 {
+					fmt.Println("  (dry run: not applied)")
+				}
+				return nil
+			}
+
 			db, err := index.OpenDB(cfg.DBPath)
 			if err != nil {
 				return fmt.Errorf("open db: %w", err)
 			}
 			defer db.Close()
+			if len(pending) > 0 {
+				fmt.Println("  Schema: migrated")
+			}
 
 			sessionCount, err := db.SessionCount()
 			if err != nil {
@@ -69,6 +116,11 @@ func doctorCmd() *cobra.Command {
 
 			fmt.Printf("  Sessions: %d\n", sessionCount)
 			fmt.Printf("  Chunks:   %d\n", chunkCount)
+			if db.WatcherRunning() {
+				fmt.Println("  Watcher:  running")
+			} else {
+				fmt.Println("  Watcher:  not running")
+			}
 
 			// check FTS5
 			fmt.Println("\n=== FTS5 ===")
@@ -84,6 +136,11 @@ func doctorCmd() *cobra.Command {
 					fmt.Printf("  Status: MISMATCH (chunks=%d, fts=%d)\n", chunkCount, ftsCount)
 				}
 			}
+			if _, err := db.Raw().Exec("INSERT INTO chunks_trigram(chunks_trigram) VALUES('integrity-check')"); err != nil {
+				fmt.Printf("  Trigram index: %v\n", err)
+			} else {
+				fmt.Println("  Trigram index: OK")
+			}
 
 			// check DB file size
 			if info, err := os.Stat(cfg.DBPath); err == nil {
@@ -94,6 +151,10 @@ func doctorCmd() *cobra.Command {
 			return nil
 		},
 	}
+
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show pending schema migrations without applying them")
+
+	return cmd
 }
 
 func checkDir(name, path string) {
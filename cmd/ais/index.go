@@ -1,18 +1,21 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
 
 	"github.com/Zuo-Peng/ai-session-search/internal/config"
 	"github.com/Zuo-Peng/ai-session-search/internal/index"
+	"github.com/Zuo-Peng/ai-session-search/internal/source"
+	"github.com/Zuo-Peng/ai-session-search/internal/tui"
 	"github.com/spf13/cobra"
 )
 
 func indexCmd() *cobra.Command {
 	return &cobra.Command{
 		Use:   "index",
-		Short: "Scan and index Claude Code and Codex conversation logs",
+		Short: "Scan and index agent conversation logs",
 		RunE: func(cmd *cobra.Command, args []string) error {
 			cfg, err := config.Load()
 			if err != nil {
@@ -26,10 +29,26 @@ func indexCmd() *cobra.Command {
 			defer db.Close()
 
 			fmt.Fprintf(os.Stderr, "Scanning roots...\n")
-			fmt.Fprintf(os.Stderr, "  Claude: %s\n", cfg.ClaudeRoot)
-			fmt.Fprintf(os.Stderr, "  Codex:  %s\n", cfg.CodexRoot)
+			for i, hc := range cfg.HostConfigs() {
+				for _, src := range source.All() {
+					for _, root := range src.Roots(hc) {
+						if i > 0 && root == "" {
+							continue
+						}
+						fmt.Fprintf(os.Stderr, "  %-7s %s\n", rootLabel(src, hc, i), root)
+					}
+				}
+			}
 
-			stats, err := index.IndexAll(db, cfg.ClaudeRoot, cfg.CodexRoot)
+			release, err := lockIndex(db)
+			if err != nil {
+				return err
+			}
+			defer release()
+
+			progress := newIndexProgress()
+			stats, err := index.IndexAll(db, cfg, progress.event)
+			progress.clear()
 			if err != nil {
 				return fmt.Errorf("index: %w", err)
 			}
@@ -39,3 +58,52 @@ func indexCmd() *cobra.Command {
 		},
 	}
 }
+
+// lockIndex takes the index lock for a command that writes the index,
+// saying so while it waits for another process that is indexing.
+func lockIndex(db *index.DB) (release func(), err error) {
+	release, err = db.LockIndex(false)
+	var locked *index.LockedError
+	if errors.As(err, &locked) {
+		fmt.Fprintf(os.Stderr, "Waiting: %v...\n", locked)
+		release, err = db.LockIndex(true)
+	}
+	return release, err
+}
+
+// rootLabel names a source's root in listings, with the host for roots of
+// other machines, e.g. "claude:" or "claude@workstation:".
+func rootLabel(src source.Source, hc *config.Config, i int) string {
+	if i == 0 {
+		return src.Name() + ":"
+	}
+	return src.Name() + "@" + hc.Host + ":"
+}
+
+// autoIndex brings the index up to date before a search or listing, unless
+// a watcher keeps it current. While another process is indexing, the data
+// already indexed is used as it is.
+func autoIndex(db *index.DB, cfg *config.Config) {
+	if db.WatcherRunning() {
+		return
+	}
+	progress := newIndexProgress()
+	_, err := index.IndexAll(db, cfg, progress.event)
+	progress.clear()
+	var locked *index.LockedError
+	if errors.As(err, &locked) {
+		fmt.Fprintf(os.Stderr, "%v; using the current index\n", locked)
+	}
+}
+
+// backgroundIndex is autoIndex for the TUI, which runs it while the current
+// index is already browsable. It is nil when a watcher keeps the index
+// current.
+func backgroundIndex(db *index.DB, cfg *config.Config) tui.IndexFunc {
+	if db.WatcherRunning() {
+		return nil
+	}
+	return func(progress index.Progress) (index.Stats, error) {
+		return index.IndexAll(db, cfg, progress)
+	}
+}
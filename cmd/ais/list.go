@@ -9,8 +9,9 @@ import (
 )
 
 func listCmd() *cobra.Command {
-	var source, since string
+	var source, since, until, model, branch, remote, host string
 	var limit int
+	var includeSubagents bool
 
 	cmd := &cobra.Command{
 		Use:   "list",
@@ -29,21 +30,32 @@ func listCmd() *cobra.Command {
 			}
 			defer db.Close()
 
-			index.IndexAll(db, cfg.ClaudeRoot, cfg.CodexRoot)
-
 			opts := search.Options{
 				Source: source,
 				Since:  since,
+				Until:  until,
+				Model:  model,
+				Branch: branch,
+				Remote: remote,
+				Host:   host,
 				Limit:  limit,
+
+				IncludeSubagents: includeSubagents,
 			}
 
-			return tui.RunList(db, opts)
+			return tui.RunList(db, opts, backgroundIndex(db, cfg))
 		},
 	}
 
-	cmd.Flags().StringVar(&source, "source", "", "Filter by source (claude/codex)")
-	cmd.Flags().StringVar(&since, "since", "", "Filter sessions updated since date (YYYY-MM-DD)")
+	cmd.Flags().StringVar(&source, "source", "", "Filter by source ("+sourceNames()+")")
+	cmd.Flags().StringVar(&since, "since", "", "Only sessions updated since a date or age (2026-03-01, 3d, 2w, yesterday, last monday)")
+	cmd.Flags().StringVar(&until, "until", "", "Only sessions updated until a date or age, through the end of a day")
+	cmd.Flags().StringVar(&model, "model", "", "Filter by model name (substring, e.g. opus)")
+	cmd.Flags().StringVar(&branch, "branch", "", "Filter by git branch")
+	cmd.Flags().StringVar(&remote, "remote", "", "Filter by git remote URL (any clone of the same repo)")
+	cmd.Flags().StringVar(&host, "host", "", "Filter by the machine sessions ran on")
 	cmd.Flags().IntVar(&limit, "limit", 0, "Max results (0 = no limit)")
+	cmd.Flags().BoolVar(&includeSubagents, "include-subagents", false, "Include Claude subagent transcripts")
 
 	return cmd
 }
@@ -5,6 +5,12 @@ import (
 	"os"
 
 	"github.com/spf13/cobra"
+
+	// log formats register themselves with the source registry
+	_ "github.com/Zuo-Peng/ai-session-search/internal/source/aider"
+	_ "github.com/Zuo-Peng/ai-session-search/internal/source/claude"
+	_ "github.com/Zuo-Peng/ai-session-search/internal/source/codex"
+	_ "github.com/Zuo-Peng/ai-session-search/internal/source/gemini"
 )
 
 var version = "dev"
@@ -12,11 +18,15 @@ var version = "dev"
 func main() {
 	rootCmd := &cobra.Command{
 		Use:     "ais",
-		Short:   "AI Session Searcher - search Claude Code and Codex conversation logs",
+		Short:   "AI Session Searcher - search Claude Code, Codex and Gemini CLI conversation logs",
 		Version: version,
 	}
 
 	rootCmd.AddCommand(indexCmd())
+	rootCmd.AddCommand(watchCmd())
+	rootCmd.AddCommand(pruneCmd())
+	rootCmd.AddCommand(exportBundleCmd())
+	rootCmd.AddCommand(importBundleCmd())
 	rootCmd.AddCommand(searchCmd())
 	rootCmd.AddCommand(listCmd())
 	rootCmd.AddCommand(previewCmd())
@@ -30,7 +30,7 @@ func previewCmd() *cobra.Command {
 			}
 			defer db.Close()
 
-			out, _, err := render.RenderConversation(db, args[0], render.Options{
+			out, _, err := render.RenderConversation(cmd.Context(), db, args[0], render.Options{
 				HitChunkID: hitChunkID,
 				Context:    context,
 				Query:      query,
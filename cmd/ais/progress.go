@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Zuo-Peng/ai-session-search/internal/index"
+	"golang.org/x/term"
+)
+
+const (
+	progressWidth    = 30
+	progressInterval = 100 * time.Millisecond
+)
+
+// indexProgress shows an index pass on stderr: a progress bar while files
+// are indexed, if stderr is a terminal, and a warning for each file that
+// fails. Nothing is written to stdout, which may be piped TSV.
+type indexProgress struct {
+	bar   bool
+	shown bool      // the bar is on the current line
+	drawn time.Time // last redraw
+}
+
+func newIndexProgress() *indexProgress {
+	return &indexProgress{bar: term.IsTerminal(int(os.Stderr.Fd()))}
+}
+
+func (p *indexProgress) event(ev index.Event) {
+	if ev.Kind == index.EventError {
+		p.clear()
+		fmt.Fprintf(os.Stderr, "warn: %v\n", ev)
+	}
+	if !p.bar || ev.Total == 0 {
+		return
+	}
+	if ev.Done == ev.Total || time.Since(p.drawn) >= progressInterval {
+		p.draw(ev.Done, ev.Total)
+	}
+}
+
+func (p *indexProgress) draw(done, total int) {
+	filled := done * progressWidth / total
+	fmt.Fprintf(os.Stderr, "\r\033[K  [%s%s] %d/%d files",
+		strings.Repeat("=", filled), strings.Repeat(" ", progressWidth-filled), done, total)
+	p.shown = true
+	p.drawn = time.Now()
+}
+
+// clear removes the bar, before a warning or once the pass is over.
+func (p *indexProgress) clear() {
+	if p.shown {
+		fmt.Fprint(os.Stderr, "\r\033[K")
+		p.shown = false
+		p.drawn = time.Time{}
+	}
+}
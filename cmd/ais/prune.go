@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/Zuo-Peng/ai-session-search/internal/config"
+	"github.com/Zuo-Peng/ai-session-search/internal/index"
+	"github.com/Zuo-Peng/ai-session-search/internal/search"
+	"github.com/spf13/cobra"
+)
+
+func pruneCmd() *cobra.Command {
+	var archived bool
+	var olderThan string
+
+	cmd := &cobra.Command{
+		Use:   "prune",
+		Short: "Delete archived sessions from the index",
+		Long: `Delete sessions kept by the archive option after their log file was deleted.
+Without --older-than every archived session is deleted.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if !archived {
+				return fmt.Errorf("only archived sessions can be pruned; pass --archived")
+			}
+			before := time.Now()
+			if olderThan != "" {
+				age, err := search.ParseAge(olderThan)
+				if err != nil {
+					return fmt.Errorf("--older-than: %w", err)
+				}
+				before = before.Add(-age)
+			}
+
+			cfg, err := config.Load()
+			if err != nil {
+				return fmt.Errorf("load config: %w", err)
+			}
+
+			db, err := index.OpenDB(cfg.DBPath)
+			if err != nil {
+				return fmt.Errorf("open db: %w", err)
+			}
+			defer db.Close()
+
+			release, err := lockIndex(db)
+			if err != nil {
+				return err
+			}
+			defer release()
+
+			n, err := db.PruneArchived(before.UTC().Format("2006-01-02T15:04:05Z"))
+			if err != nil {
+				return fmt.Errorf("prune: %w", err)
+			}
+			fmt.Fprintf(os.Stderr, "Pruned %d archived sessions\n", n)
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&archived, "archived", false, "Delete archived sessions (required)")
+	cmd.Flags().StringVar(&olderThan, "older-than", "", "Only sessions last updated longer ago than this (e.g. 90d, 2w, 12h)")
+
+	return cmd
+}
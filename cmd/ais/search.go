@@ -8,6 +8,7 @@ import (
 	"github.com/Zuo-Peng/ai-session-search/internal/config"
 	"github.com/Zuo-Peng/ai-session-search/internal/index"
 	"github.com/Zuo-Peng/ai-session-search/internal/search"
+	"github.com/Zuo-Peng/ai-session-search/internal/source"
 	"github.com/Zuo-Peng/ai-session-search/internal/tui"
 	"github.com/spf13/cobra"
 	"golang.org/x/term"
@@ -16,20 +17,20 @@ import (
 const (
 	sColorReset   = "\033[0m"
 	sColorBoldRed = "\033[1;31m"
-	sColorBlue    = "\033[1;34m"
-	sColorGreen   = "\033[1;32m"
 	sColorDim     = "\033[2m"
 )
 
-func colorizeSource(source string) string {
-	switch source {
-	case "claude":
-		return sColorBlue + source + sColorReset
-	case "codex":
-		return sColorGreen + source + sColorReset
-	default:
-		return source
+func colorizeSource(name string) string {
+	src := source.Get(name)
+	if src == nil {
+		return name
 	}
+	return "\033[1;38;5;" + src.Color() + "m" + name + sColorReset
+}
+
+// sourceNames lists the registered sources for flag help, e.g. "claude/codex".
+func sourceNames() string {
+	return strings.Join(source.Names(), "/")
 }
 
 func colorizeSnippet(snippet string) string {
@@ -39,14 +40,24 @@ func colorizeSnippet(snippet string) string {
 }
 
 func searchCmd() *cobra.Command {
-	var source, role, since string
+	var source, role, kind, since, until, model, branch, remote, host string
 	var limit int
+	var includeSubagents, substring bool
 
 	cmd := &cobra.Command{
 		Use:   "search <query>",
 		Short: "Full-text search across indexed conversations",
-		Long: `Search indexed conversations using FTS5. Output is TSV for fzf integration:
-  sessionKey, chunkId, updatedAt, source, repo, summary, snippet
+		Long: `Search indexed conversations using FTS5.
+
+The query holds words and "exact phrases", which must all match. OR between two
+terms makes them alternatives, -term excludes hits containing it and word*
+matches a prefix. Filters can be written into the query and take precedence over
+the flags:
+  repo:<part of path>  role:user|assistant|tool  source:<name>
+  kind:text|thinking|tool_call|tool_result  after:YYYY-MM-DD  before:YYYY-MM-DD
+
+Output is TSV for fzf integration:
+  sessionKey, chunkId, updatedAt, source, host, repo, summary, snippet
 
 Recommended shell function (add to .zshrc):
   aisf() {
@@ -60,6 +71,10 @@ Recommended shell function (add to .zshrc):
   }`,
 		Args: cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
+			// a query that does not parse is explained by its error; the
+			// flag listing would bury that
+			cmd.SilenceUsage = true
+
 			cfg, err := config.Load()
 			if err != nil {
 				return err
@@ -71,23 +86,33 @@ Recommended shell function (add to .zshrc):
 			}
 			defer db.Close()
 
-			// Auto-update index before searching
-			index.IndexAll(db, cfg.ClaudeRoot, cfg.CodexRoot)
-
 			opts := search.Options{
 				Source: source,
 				Role:   role,
+				Kind:   kind,
 				Since:  since,
+				Until:  until,
+				Model:  model,
+				Branch: branch,
+				Remote: remote,
+				Host:   host,
 				Limit:  limit,
+
+				Substring:        substring,
+				IncludeSubagents: includeSubagents,
 			}
 
-			// Interactive TUI when stdout is a terminal; TSV output for pipes
+			// Interactive TUI when stdout is a terminal, updating the index
+			// in the background; TSV output for pipes
 			if term.IsTerminal(int(os.Stdout.Fd())) {
-				return tui.Run(db, args[0], opts)
+				return tui.Run(db, args[0], opts, backgroundIndex(db, cfg))
 			}
 
+			// Auto-update index before searching
+			autoIndex(db, cfg)
+
 			opts.Query = args[0]
-			results, err := search.Search(db, opts)
+			results, err := search.Search(cmd.Context(), db, opts)
 			if err != nil {
 				return err
 			}
@@ -107,12 +132,17 @@ Recommended shell function (add to .zshrc):
 				if repo == "" {
 					repo = "-"
 				}
+				host := r.Host
+				if host == "" {
+					host = "-"
+				}
 				// first two fields (sessionKey, chunkID) stay plain for fzf {1} {2}
-				fmt.Printf("%s\t%d\t%s%s%s\t%s\t%s\t%s\t%s\n",
+				fmt.Printf("%s\t%d\t%s%s%s\t%s\t%s\t%s\t%s\t%s\n",
 					r.SessionKey,
 					r.ChunkID,
 					sColorDim, r.UpdatedAt, sColorReset,
 					colorizeSource(r.Source),
+					host,
 					repo,
 					summary,
 					snippet,
@@ -122,10 +152,18 @@ Recommended shell function (add to .zshrc):
 		},
 	}
 
-	cmd.Flags().StringVar(&source, "source", "", "Filter by source (claude/codex)")
-	cmd.Flags().StringVar(&role, "role", "", "Filter by role (user/assistant)")
-	cmd.Flags().StringVar(&since, "since", "", "Filter sessions updated since date (YYYY-MM-DD)")
+	cmd.Flags().StringVar(&source, "source", "", "Filter by source ("+sourceNames()+")")
+	cmd.Flags().StringVar(&role, "role", "", "Filter by role (user/assistant/tool)")
+	cmd.Flags().StringVar(&kind, "kind", "", "Filter by chunk kind (text/thinking/tool_call/tool_result)")
+	cmd.Flags().StringVar(&since, "since", "", "Only hits since a date or age (2026-03-01, 3d, 2w, yesterday, last monday)")
+	cmd.Flags().StringVar(&until, "until", "", "Only hits until a date or age, through the end of a day")
+	cmd.Flags().StringVar(&model, "model", "", "Filter by model name (substring, e.g. opus)")
+	cmd.Flags().StringVar(&branch, "branch", "", "Filter by git branch")
+	cmd.Flags().StringVar(&remote, "remote", "", "Filter by git remote URL (any clone of the same repo)")
+	cmd.Flags().StringVar(&host, "host", "", "Filter by the machine sessions ran on")
 	cmd.Flags().IntVar(&limit, "limit", 100, "Max results")
+	cmd.Flags().BoolVar(&substring, "substring", false, "Match terms anywhere inside words (trigram index)")
+	cmd.Flags().BoolVar(&includeSubagents, "include-subagents", false, "Include Claude subagent transcripts")
 
 	return cmd
 }
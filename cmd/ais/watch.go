@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/Zuo-Peng/ai-session-search/internal/config"
+	"github.com/Zuo-Peng/ai-session-search/internal/index"
+	"github.com/Zuo-Peng/ai-session-search/internal/watch"
+	"github.com/spf13/cobra"
+)
+
+func watchCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "watch",
+		Short: "Keep the index up to date as conversation logs change",
+		Long: `Indexes once, then watches the log directories with inotify (Linux only) and
+re-indexes changed files within a second. While it runs, search and list skip
+their startup scan.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Load()
+			if err != nil {
+				return fmt.Errorf("load config: %w", err)
+			}
+
+			db, err := index.OpenDB(cfg.DBPath)
+			if err != nil {
+				return fmt.Errorf("open db: %w", err)
+			}
+			defer db.Close()
+
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
+			return watch.Run(ctx, db, cfg, func(format string, args ...any) {
+				fmt.Fprintf(os.Stderr, "%s "+format+"\n", append([]any{time.Now().Format("15:04:05")}, args...)...)
+			})
+		},
+	}
+}
@@ -0,0 +1,273 @@
+// Package bundle reads and writes portable index bundles: gzip-compressed
+// JSON lines holding sessions and their chunks, so the history indexed on one
+// machine can be searched on another.
+//
+// The first line is a Header; every following line is one Session with its
+// chunks.
+package bundle
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/Zuo-Peng/ai-session-search/internal/index"
+)
+
+const (
+	formatName = "ais-bundle"
+
+	// Version is bumped when the format changes incompatibly; readers refuse
+	// bundles newer than they know.
+	Version = 1
+)
+
+// Header starts every bundle.
+type Header struct {
+	Format    string `json:"format"`
+	Version   int    `json:"version"`
+	Host      string `json:"host"` // machine the bundle was exported on
+	CreatedAt string `json:"created_at"`
+}
+
+type Session struct {
+	SessionKey       string  `json:"session_key"`
+	Source           string  `json:"source"`
+	FilePath         string  `json:"file_path"`
+	RepoCwd          string  `json:"repo_cwd,omitempty"`
+	CreatedAt        string  `json:"created_at,omitempty"`
+	UpdatedAt        string  `json:"updated_at,omitempty"`
+	Summary          string  `json:"summary,omitempty"`
+	ParentSessionKey string  `json:"parent_session_key,omitempty"`
+	GitBranch        string  `json:"git_branch,omitempty"`
+	Model            string  `json:"model,omitempty"`
+	CLIVersion       string  `json:"cli_version,omitempty"`
+	RepoURL          string  `json:"repo_url,omitempty"`
+	GitCommit        string  `json:"git_commit,omitempty"`
+	Host             string  `json:"host"` // machine the session ran on
+	ContentHash      string  `json:"content_hash"`
+	Chunks           []Chunk `json:"chunks"`
+}
+
+type Chunk struct {
+	ChunkID      int    `json:"chunk_id"`
+	Ts           string `json:"ts,omitempty"`
+	Role         string `json:"role"`
+	Kind         string `json:"kind"`
+	Tool         string `json:"tool,omitempty"`
+	Text         string `json:"text"`
+	LineNumber   int    `json:"line_number,omitempty"`
+	MsgID        int    `json:"msg_id"`
+	MsgOffset    int    `json:"msg_offset,omitempty"`
+	UUID         string `json:"uuid,omitempty"`
+	ParentUUID   string `json:"parent_uuid,omitempty"`
+	Model        string `json:"model,omitempty"`
+	InputTokens  int    `json:"input_tokens,omitempty"`
+	OutputTokens int    `json:"output_tokens,omitempty"`
+}
+
+// Stats counts what Import did with the sessions of a bundle.
+type Stats struct {
+	Added     int
+	Updated   int
+	Duplicate int
+	Conflict  int
+}
+
+func (s Stats) String() string {
+	return fmt.Sprintf("added=%d updated=%d duplicate=%d conflict=%d",
+		s.Added, s.Updated, s.Duplicate, s.Conflict)
+}
+
+// Export writes the given sessions to w as a bundle. Each session keeps the
+// host recorded for it; host tags those with none.
+func Export(db *index.DB, w io.Writer, keys []string, host string) (int, error) {
+	zw := gzip.NewWriter(w)
+	enc := json.NewEncoder(zw)
+	enc.SetEscapeHTML(false)
+
+	if err := enc.Encode(Header{
+		Format:    formatName,
+		Version:   Version,
+		Host:      host,
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+	}); err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for _, key := range keys {
+		s, err := db.GetSessionByKey(key)
+		if err != nil {
+			return n, fmt.Errorf("get session %s: %w", key, err)
+		}
+		if s == nil {
+			continue
+		}
+		chunks, err := db.GetChunks(key)
+		if err != nil {
+			return n, fmt.Errorf("get chunks %s: %w", key, err)
+		}
+		if err := enc.Encode(toBundle(s, chunks, host)); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, zw.Close()
+}
+
+// Import merges the sessions of the bundle in r into db; see
+// index.DB.ImportSession for how existing sessions are treated. Sessions of
+// a host other than localHost are keyed as index.HostKey has it, the same as
+// when their logs are indexed from a [[hosts]] root, and localHost's own
+// sessions by their local keys.
+func Import(db *index.DB, r io.Reader, localHost string) (Header, Stats, error) {
+	var stats Stats
+
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return Header{}, stats, fmt.Errorf("not an ais bundle: %w", err)
+	}
+	dec := json.NewDecoder(bufio.NewReader(zr))
+
+	var h Header
+	if err := dec.Decode(&h); err != nil || h.Format != formatName {
+		return h, stats, fmt.Errorf("not an ais bundle")
+	}
+	if h.Version > Version {
+		return h, stats, fmt.Errorf("bundle version %d is newer than this ais supports (%d)", h.Version, Version)
+	}
+
+	for {
+		var s Session
+		if err := dec.Decode(&s); err == io.EOF {
+			break
+		} else if err != nil {
+			return h, stats, fmt.Errorf("read bundle: %w", err)
+		}
+		if s.Host == "" {
+			s.Host = h.Host
+		}
+		s.SessionKey = importKey(s.SessionKey, s.Host, localHost)
+		if s.ParentSessionKey != "" {
+			s.ParentSessionKey = importKey(s.ParentSessionKey, s.Host, localHost)
+		}
+
+		row, chunks := fromBundle(&s)
+		if s.ContentHash != "" && s.ContentHash != index.ContentHash(chunks) {
+			return h, stats, fmt.Errorf("session %s: content does not match its hash", s.SessionKey)
+		}
+		res, err := db.ImportSession(row, chunks)
+		if err != nil {
+			return h, stats, fmt.Errorf("import %s: %w", s.SessionKey, err)
+		}
+		switch res {
+		case index.ImportAdded:
+			stats.Added++
+		case index.ImportUpdated:
+			stats.Updated++
+		case index.ImportDuplicate:
+			stats.Duplicate++
+		case index.ImportConflict:
+			stats.Conflict++
+		}
+	}
+	return h, stats, nil
+}
+
+// importKey is the key a session of host is stored under on localHost. A
+// session of localHost itself may come back from a machine that imported
+// it, keyed with the host prefix there; it gets its local key again.
+func importKey(key, host, localHost string) string {
+	if host == localHost {
+		return strings.TrimPrefix(key, localHost+"/")
+	}
+	return index.HostKey(host, key)
+}
+
+func toBundle(s *index.SessionRow, chunks []index.ChunkRow, host string) Session {
+	if s.Host != "" {
+		host = s.Host
+	}
+	bs := Session{
+		SessionKey:       s.SessionKey,
+		Source:           s.Source,
+		FilePath:         s.FilePath,
+		RepoCwd:          s.RepoCwd,
+		CreatedAt:        s.CreatedAt,
+		UpdatedAt:        s.UpdatedAt,
+		Summary:          s.Summary,
+		ParentSessionKey: s.ParentSessionKey,
+		GitBranch:        s.GitBranch,
+		Model:            s.Model,
+		CLIVersion:       s.CLIVersion,
+		RepoURL:          s.RepoURL,
+		GitCommit:        s.GitCommit,
+		Host:             host,
+		ContentHash:      index.ContentHash(chunks),
+		Chunks:           make([]Chunk, len(chunks)),
+	}
+	for i, c := range chunks {
+		bs.Chunks[i] = Chunk{
+			ChunkID:      c.ChunkID,
+			Ts:           c.Ts,
+			Role:         c.Role,
+			Kind:         c.Kind,
+			Tool:         c.Tool,
+			Text:         c.Text,
+			LineNumber:   c.LineNumber,
+			MsgID:        c.MsgID,
+			MsgOffset:    c.MsgOffset,
+			UUID:         c.UUID,
+			ParentUUID:   c.ParentUUID,
+			Model:        c.Model,
+			InputTokens:  c.InputTokens,
+			OutputTokens: c.OutputTokens,
+		}
+	}
+	return bs
+}
+
+func fromBundle(s *Session) (index.SessionRow, []index.ChunkRow) {
+	row := index.SessionRow{
+		SessionKey:       s.SessionKey,
+		Source:           s.Source,
+		FilePath:         s.FilePath,
+		RepoCwd:          s.RepoCwd,
+		CreatedAt:        s.CreatedAt,
+		UpdatedAt:        s.UpdatedAt,
+		Summary:          s.Summary,
+		ParentSessionKey: s.ParentSessionKey,
+		GitBranch:        s.GitBranch,
+		Model:            s.Model,
+		CLIVersion:       s.CLIVersion,
+		RepoURL:          s.RepoURL,
+		GitCommit:        s.GitCommit,
+		Host:             s.Host,
+	}
+	chunks := make([]index.ChunkRow, len(s.Chunks))
+	for i, c := range s.Chunks {
+		chunks[i] = index.ChunkRow{
+			SessionKey:   s.SessionKey,
+			ChunkID:      c.ChunkID,
+			Ts:           c.Ts,
+			Role:         c.Role,
+			Kind:         c.Kind,
+			Tool:         c.Tool,
+			Text:         c.Text,
+			LineNumber:   c.LineNumber,
+			MsgID:        c.MsgID,
+			MsgOffset:    c.MsgOffset,
+			UUID:         c.UUID,
+			ParentUUID:   c.ParentUUID,
+			Model:        c.Model,
+			InputTokens:  c.InputTokens,
+			OutputTokens: c.OutputTokens,
+		}
+	}
+	return row, chunks
+}
@@ -0,0 +1,130 @@
+package bundle
+
+import (
+	"bytes"
+	"maps"
+	"path/filepath"
+	"testing"
+
+	"github.com/Zuo-Peng/ai-session-search/internal/index"
+)
+
+func openDB(t *testing.T) *index.DB {
+	t.Helper()
+	db, err := index.OpenDB(filepath.Join(t.TempDir(), "ais.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// addLocal stores a session as if indexed from a log file on this machine.
+func addLocal(t *testing.T, db *index.DB, key, parent, host, text string) {
+	t.Helper()
+	_, err := db.Raw().Exec(
+		`INSERT INTO sessions (session_key, source, file_path, parent_session_key, host) VALUES (?, 'claude', ?, ?, ?)`,
+		key, "/logs/"+key+".jsonl", parent, host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Raw().Exec(`INSERT INTO chunks (session_key, chunk_id, role, text) VALUES (?, 0, 'user', ?)`, key, text)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func export(t *testing.T, db *index.DB, host string, keys ...string) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	if _, err := Export(db, &buf, keys, host); err != nil {
+		t.Fatal(err)
+	}
+	return &buf
+}
+
+func sessionKeys(t *testing.T, db *index.DB) map[string]string {
+	t.Helper()
+	rows, err := db.Raw().Query(`SELECT session_key, parent_session_key FROM sessions`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	keys := make(map[string]string)
+	for rows.Next() {
+		var key, parent string
+		if err := rows.Scan(&key, &parent); err != nil {
+			t.Fatal(err)
+		}
+		keys[key] = parent
+	}
+	return keys
+}
+
+// TestImportRoundTrip sends sessions of host b to a, and back: a keys them
+// with b's prefix, and b recognises them as its own local sessions.
+func TestImportRoundTrip(t *testing.T) {
+	dbA, dbB := openDB(t), openDB(t)
+	addLocal(t, dbA, "claude:x", "", "a", "a's own session at the same path")
+	addLocal(t, dbB, "claude:x", "", "b", "fix the flaky test")
+	addLocal(t, dbB, "claude:x/subagents/s1", "claude:x", "b", "find the flaky test")
+
+	_, stats, err := Import(dbA, export(t, dbB, "b", "claude:x", "claude:x/subagents/s1"), "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats != (Stats{Added: 2}) {
+		t.Errorf("import into a: %s, want added=2", stats)
+	}
+	want := map[string]string{
+		"claude:x":                "",
+		"b/claude:x":              "",
+		"b/claude:x/subagents/s1": "b/claude:x",
+	}
+	if got := sessionKeys(t, dbA); !maps.Equal(got, want) {
+		t.Errorf("a's sessions = %v, want %v", got, want)
+	}
+
+	// importing the same bundle again changes nothing
+	_, stats, err = Import(dbA, export(t, dbB, "b", "claude:x", "claude:x/subagents/s1"), "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats != (Stats{Duplicate: 2}) {
+		t.Errorf("second import into a: %s, want duplicate=2", stats)
+	}
+
+	// a exports b's sessions, still tagged with host b, back to b
+	_, stats, err = Import(dbB, export(t, dbA, "a", "b/claude:x", "b/claude:x/subagents/s1"), "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats != (Stats{Duplicate: 2}) {
+		t.Errorf("import back into b: %s, want duplicate=2", stats)
+	}
+	want = map[string]string{
+		"claude:x":              "",
+		"claude:x/subagents/s1": "claude:x",
+	}
+	if got := sessionKeys(t, dbB); !maps.Equal(got, want) {
+		t.Errorf("b's sessions = %v, want %v", got, want)
+	}
+}
+
+func TestImportKey(t *testing.T) {
+	tests := []struct {
+		key, host, localHost string
+		want                 string
+	}{
+		{"claude:x", "b", "a", "b/claude:x"},
+		{"b/claude:x", "b", "a", "b/claude:x"},
+		{"claude:x", "a", "a", "claude:x"},
+		{"a/claude:x", "a", "a", "claude:x"},
+		{"c/claude:x", "a", "a", "c/claude:x"},
+	}
+	for _, tt := range tests {
+		if got := importKey(tt.key, tt.host, tt.localHost); got != tt.want {
+			t.Errorf("importKey(%q, %q, %q) = %q, want %q", tt.key, tt.host, tt.localHost, got, tt.want)
+		}
+	}
+}
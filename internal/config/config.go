@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/BurntSushi/toml"
 )
@@ -11,7 +12,53 @@ import (
 type Config struct {
 	ClaudeRoot string `toml:"claude_root"`
 	CodexRoot  string `toml:"codex_root"`
+	GeminiRoot string `toml:"gemini_root"`
 	DBPath     string `toml:"db_path"`
+
+	// AiderRoots are directories searched for per-repo .aider.chat.history.md
+	// files. Empty by default since aider has no central log directory.
+	AiderRoots []string `toml:"aider_roots"`
+
+	// Host names this machine on the sessions indexed from the roots above;
+	// defaults to the hostname.
+	Host string `toml:"host"`
+
+	// Hosts are log roots of other machines, e.g. rsynced copies of their
+	// ~/.claude/projects, indexed with that machine's name as the host.
+	Hosts []HostRoots `toml:"hosts"`
+
+	// Archive keeps sessions whose log file was deleted, marked archived,
+	// instead of removing them from the index. They stay searchable until
+	// removed with `ais prune --archived`.
+	Archive bool `toml:"archive"`
+}
+
+// HostRoots is the set of log roots of another machine. Unset roots are not
+// scanned.
+type HostRoots struct {
+	Name       string   `toml:"name"`
+	ClaudeRoot string   `toml:"claude_root"`
+	CodexRoot  string   `toml:"codex_root"`
+	GeminiRoot string   `toml:"gemini_root"`
+	AiderRoots []string `toml:"aider_roots"`
+}
+
+// HostConfigs returns c followed by a copy of c for each of Hosts, with that
+// host's name and roots in place of the local ones, so sources can take the
+// roots of any host from the usual fields.
+func (c *Config) HostConfigs() []*Config {
+	cfgs := []*Config{c}
+	for _, h := range c.Hosts {
+		hc := *c
+		hc.Host = h.Name
+		hc.Hosts = nil
+		hc.ClaudeRoot = h.ClaudeRoot
+		hc.CodexRoot = h.CodexRoot
+		hc.GeminiRoot = h.GeminiRoot
+		hc.AiderRoots = h.AiderRoots
+		cfgs = append(cfgs, &hc)
+	}
+	return cfgs
 }
 
 func Load() (*Config, error) {
@@ -23,6 +70,7 @@ func Load() (*Config, error) {
 	cfg := &Config{
 		ClaudeRoot: filepath.Join(home, ".claude", "projects"),
 		CodexRoot:  filepath.Join(home, ".codex", "sessions"),
+		GeminiRoot: filepath.Join(home, ".gemini", "tmp"),
 		DBPath:     filepath.Join(home, ".config", "ais", "ais.db"),
 	}
 
@@ -36,11 +84,39 @@ func Load() (*Config, error) {
 	// expand ~ in paths
 	cfg.ClaudeRoot = expandHome(cfg.ClaudeRoot, home)
 	cfg.CodexRoot = expandHome(cfg.CodexRoot, home)
+	cfg.GeminiRoot = expandHome(cfg.GeminiRoot, home)
 	cfg.DBPath = expandHome(cfg.DBPath, home)
+	expandAiderRoots(cfg.AiderRoots, home)
+
+	if cfg.Host == "" {
+		if cfg.Host, err = os.Hostname(); err != nil {
+			return nil, fmt.Errorf("hostname: %w", err)
+		}
+	}
+	seen := map[string]bool{cfg.Host: true}
+	for i := range cfg.Hosts {
+		h := &cfg.Hosts[i]
+		if h.Name == "" || seen[h.Name] {
+			return nil, fmt.Errorf("config %s: [[hosts]] need a unique name other than this host's (%q)", cfgPath, h.Name)
+		}
+		seen[h.Name] = true
+		h.ClaudeRoot = expandHome(h.ClaudeRoot, home)
+		h.CodexRoot = expandHome(h.CodexRoot, home)
+		h.GeminiRoot = expandHome(h.GeminiRoot, home)
+		expandAiderRoots(h.AiderRoots, home)
+	}
 
 	return cfg, nil
 }
 
+func expandAiderRoots(roots []string, home string) {
+	for i, root := range roots {
+		// accept "~/code/**" as well as "~/code"; the search is always recursive
+		root = strings.TrimSuffix(strings.TrimSuffix(root, "/**"), "/")
+		roots[i] = expandHome(root, home)
+	}
+}
+
 func expandHome(path, home string) string {
 	if len(path) > 1 && path[0] == '~' && path[1] == '/' {
 		return filepath.Join(home, path[2:])
@@ -1,67 +1,35 @@
 package index
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
 
+	"github.com/Zuo-Peng/ai-session-search/internal/parse"
 	_ "modernc.org/sqlite"
 )
 
-const schema = `
+// pragmas are applied on every open; tables are created by migrations,
+// see migrate.go.
+const pragmas = `
 PRAGMA journal_mode = WAL;
 PRAGMA synchronous = NORMAL;
 PRAGMA cache_size = -64000;
 PRAGMA busy_timeout = 5000;
-
-CREATE TABLE IF NOT EXISTS sessions (
-    session_key TEXT PRIMARY KEY,
-    source      TEXT NOT NULL,
-    file_path   TEXT NOT NULL,
-    repo_cwd    TEXT NOT NULL DEFAULT '',
-    created_at  TEXT NOT NULL DEFAULT '',
-    updated_at  TEXT NOT NULL DEFAULT '',
-    summary     TEXT NOT NULL DEFAULT '',
-    mtime       INTEGER NOT NULL DEFAULT 0,
-    size        INTEGER NOT NULL DEFAULT 0
-);
-
-CREATE TABLE IF NOT EXISTS chunks (
-    session_key TEXT NOT NULL,
-    chunk_id    INTEGER NOT NULL,
-    ts          TEXT NOT NULL DEFAULT '',
-    role        TEXT NOT NULL,
-    kind        TEXT NOT NULL DEFAULT 'text',
-    text        TEXT NOT NULL,
-    line_number INTEGER NOT NULL DEFAULT 0,
-    PRIMARY KEY (session_key, chunk_id)
-);
-
-CREATE VIRTUAL TABLE IF NOT EXISTS chunks_fts USING fts5(
-    text,
-    content=chunks,
-    content_rowid=rowid,
-    tokenize='unicode61'
-);
-
--- triggers to keep FTS in sync
-CREATE TRIGGER IF NOT EXISTS chunks_ai AFTER INSERT ON chunks BEGIN
-    INSERT INTO chunks_fts(rowid, text) VALUES (new.rowid, new.text);
-END;
-
-CREATE TRIGGER IF NOT EXISTS chunks_ad AFTER DELETE ON chunks BEGIN
-    INSERT INTO chunks_fts(chunks_fts, rowid, text) VALUES('delete', old.rowid, old.text);
-END;
-
-CREATE TRIGGER IF NOT EXISTS chunks_au AFTER UPDATE ON chunks BEGIN
-    INSERT INTO chunks_fts(chunks_fts, rowid, text) VALUES('delete', old.rowid, old.text);
-    INSERT INTO chunks_fts(rowid, text) VALUES (new.rowid, new.text);
-END;
 `
 
 type DB struct {
-	db *sql.DB
+	db   *sql.DB
+	path string
+
+	lockMu sync.Mutex
+	lock   *os.File // index lock file while held, see LockIndex
 }
 
 func OpenDB(dbPath string) (*DB, error) {
@@ -75,36 +43,123 @@ func OpenDB(dbPath string) (*DB, error) {
 		return nil, fmt.Errorf("open db: %w", err)
 	}
 
-	if _, err := db.Exec(schema); err != nil {
+	if _, err := db.Exec(pragmas); err != nil {
 		db.Close()
-		return nil, fmt.Errorf("init schema: %w", err)
+		return nil, fmt.Errorf("init db: %w", err)
+	}
+	if err := migrate(db); err != nil {
+		db.Close()
+		return nil, err
 	}
 
-	// migrate: add kind column if missing (for existing databases)
-	db.Exec("ALTER TABLE chunks ADD COLUMN kind TEXT NOT NULL DEFAULT 'text'")
-
-	// schema version tracking for forced re-index
-	db.Exec("CREATE TABLE IF NOT EXISTS meta (key TEXT PRIMARY KEY, value TEXT)")
-	d := &DB{db: db}
-	d.migrateSchemaVersion()
+	d := &DB{db: db, path: dbPath}
+	if err := d.repairOnOpen(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("repair index: %w", err)
+	}
 
 	return d, nil
 }
 
 // schemaVersion should be bumped whenever chunk parsing logic changes
-// to force a full re-index.
-const schemaVersion = "3"
+// to force a full re-index. Table changes go in migrations instead.
+const schemaVersion = "12"
 
-func (d *DB) migrateSchemaVersion() {
+// schemaOutdated reports whether the index was built with another
+// schemaVersion.
+func (d *DB) schemaOutdated() bool {
 	var ver string
 	err := d.db.QueryRow("SELECT value FROM meta WHERE key = 'schema_version'").Scan(&ver)
-	if err != nil || ver != schemaVersion {
-		// force re-index by resetting all session mtime/size to 0
-		d.db.Exec("UPDATE sessions SET mtime = 0, size = 0")
+	return err != nil || ver != schemaVersion
+}
+
+func (d *DB) migrateSchemaVersion() {
+	if d.schemaOutdated() {
+		// force a full re-index by resetting all session mtime/size/offset to 0
+		d.db.Exec("UPDATE sessions SET mtime = 0, size = 0, parsed_offset = 0")
 		d.db.Exec("INSERT OR REPLACE INTO meta (key, value) VALUES ('schema_version', ?)", schemaVersion)
 	}
 }
 
+// HeartbeatInterval is how often a running watcher refreshes its heartbeat.
+const HeartbeatInterval = 10 * time.Second
+
+// SetWatcherHeartbeat records that a watcher is keeping the index current.
+func (d *DB) SetWatcherHeartbeat() error {
+	_, err := d.db.Exec("INSERT OR REPLACE INTO meta (key, value) VALUES ('watcher_heartbeat', ?)",
+		strconv.FormatInt(time.Now().Unix(), 10))
+	return err
+}
+
+// ClearWatcherHeartbeat is called by a watcher on shutdown.
+func (d *DB) ClearWatcherHeartbeat() error {
+	_, err := d.db.Exec("DELETE FROM meta WHERE key = 'watcher_heartbeat'")
+	return err
+}
+
+// WatcherRunning reports whether a watcher has refreshed its heartbeat
+// recently enough that the index can be assumed current.
+func (d *DB) WatcherRunning() bool {
+	var v string
+	if err := d.db.QueryRow("SELECT value FROM meta WHERE key = 'watcher_heartbeat'").Scan(&v); err != nil {
+		return false
+	}
+	ts, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return false
+	}
+	return time.Since(time.Unix(ts, 0)) < 3*HeartbeatInterval
+}
+
+// beginIndexRun records in meta that this process is writing the index, so
+// that a run killed part-way is detected by the next OpenDB.
+func (d *DB) beginIndexRun() error {
+	_, err := d.db.Exec("INSERT OR REPLACE INTO meta (key, value) VALUES ('index_in_progress', ?)",
+		strconv.Itoa(os.Getpid()))
+	return err
+}
+
+// endIndexRun clears the marker set by beginIndexRun.
+func (d *DB) endIndexRun() error {
+	_, err := d.db.Exec("DELETE FROM meta WHERE key = 'index_in_progress'")
+	return err
+}
+
+// interruptedRun reports whether an index run set its marker and never
+// cleared it.
+func (d *DB) interruptedRun() bool {
+	var v string
+	return d.db.QueryRow("SELECT value FROM meta WHERE key = 'index_in_progress'").Scan(&v) == nil
+}
+
+// repairInterruptedRun checks the index when the last run never cleared its
+// marker. It is called under the index lock, so the run that set it is over. Each session is replaced in a
+// single transaction, so sessions themselves are either old or new; what is
+// checked is the rest: chunks left without a session row by older versions,
+// and the FTS indexes, which are rebuilt from chunks if they fail their
+// integrity check.
+func (d *DB) repairInterruptedRun() error {
+	if !d.interruptedRun() {
+		return nil
+	}
+
+	fmt.Fprintln(os.Stderr, "Checking index after an interrupted run...")
+	if _, err := d.db.Exec("DELETE FROM chunks WHERE session_key NOT IN (SELECT session_key FROM sessions)"); err != nil {
+		return err
+	}
+	for _, table := range []string{"chunks_fts", "chunks_trigram"} {
+		// rank 1 also compares the index against the rows of chunks
+		if _, err := d.db.Exec(fmt.Sprintf("INSERT INTO %[1]s(%[1]s, rank) VALUES('integrity-check', 1)", table)); err == nil {
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "  rebuilding %s\n", table)
+		if _, err := d.db.Exec(fmt.Sprintf("INSERT INTO %[1]s(%[1]s) VALUES('rebuild')", table)); err != nil {
+			return fmt.Errorf("rebuild %s: %w", table, err)
+		}
+	}
+	return d.endIndexRun()
+}
+
 func (d *DB) Close() error {
 	return d.db.Close()
 }
@@ -113,28 +168,51 @@ func (d *DB) Raw() *sql.DB {
 	return d.db
 }
 
+// SessionInfo is the indexing state of a session file.
 type SessionInfo struct {
-	Mtime int64
-	Size  int64
+	SessionKey string
+	Mtime      int64
+	Size       int64
+
+	// Cursor is where the last parse stopped; Offset is 0 for sources that
+	// are always parsed in full.
+	Cursor      parse.Cursor
+	NextChunkID int
+	PrefixHash  string // hash of the parsed prefix of the file, see prefixHash
 }
 
-func (d *DB) GetSessionInfo(sessionKey string) (*SessionInfo, error) {
-	var info SessionInfo
-	err := d.db.QueryRow(
-		"SELECT mtime, size FROM sessions WHERE session_key = ?",
-		sessionKey,
-	).Scan(&info.Mtime, &info.Size)
-	if err == sql.ErrNoRows {
-		return nil, nil
-	}
+// SessionInfos returns the indexing state of every session indexed from a
+// local file, keyed by file path.
+func (d *DB) SessionInfos() (map[string]*SessionInfo, error) {
+	rows, err := d.db.Query(
+		`SELECT file_path, session_key, mtime, size, parsed_offset, parsed_lines, next_chunk_id, prefix_hash, pending_tools
+		 FROM sessions WHERE imported = 0`,
+	)
 	if err != nil {
 		return nil, err
 	}
-	return &info, nil
+	defer rows.Close()
+
+	infos := make(map[string]*SessionInfo)
+	for rows.Next() {
+		var path, pending string
+		info := &SessionInfo{}
+		if err := rows.Scan(&path, &info.SessionKey, &info.Mtime, &info.Size, &info.Cursor.Offset, &info.Cursor.Line,
+			&info.NextChunkID, &info.PrefixHash, &pending); err != nil {
+			return nil, err
+		}
+		if pending != "" {
+			json.Unmarshal([]byte(pending), &info.Cursor.Pending)
+		}
+		infos[path] = info
+	}
+	return infos, rows.Err()
 }
 
-func (d *DB) AllSessionKeys() (map[string]struct{}, error) {
-	rows, err := d.db.Query("SELECT session_key FROM sessions")
+// LiveSessionKeys returns the keys of the sessions indexed from local log
+// files that are not archived.
+func (d *DB) LiveSessionKeys() (map[string]struct{}, error) {
+	rows, err := d.db.Query("SELECT session_key FROM sessions WHERE archived = 0 AND imported = 0")
 	if err != nil {
 		return nil, err
 	}
@@ -158,13 +236,62 @@ func (d *DB) DeleteSession(sessionKey string) error {
 	}
 	defer tx.Rollback()
 
-	if _, err := tx.Exec("DELETE FROM chunks WHERE session_key = ?", sessionKey); err != nil {
+	if err := deleteSession(tx, sessionKey); err != nil {
 		return err
 	}
-	if _, err := tx.Exec("DELETE FROM sessions WHERE session_key = ?", sessionKey); err != nil {
+	return tx.Commit()
+}
+
+// ArchiveSession marks a session whose log file is gone as archived; its
+// chunks stay searchable. The stored file state is reset so the session is
+// re-parsed in full should the file come back.
+func (d *DB) ArchiveSession(sessionKey string) error {
+	_, err := d.db.Exec("UPDATE sessions SET archived = 1, mtime = 0, size = 0, parsed_offset = 0 WHERE session_key = ?",
+		sessionKey)
+	return err
+}
+
+// PruneArchived deletes the archived sessions last updated before the given
+// time (RFC 3339, as stored in updated_at) and returns how many there were.
+func (d *DB) PruneArchived(before string) (int, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query("SELECT session_key FROM sessions WHERE archived = 1 AND updated_at < ?", before)
+	if err != nil {
+		return 0, err
+	}
+	var keys []string
+	for rows.Next() {
+		var k string
+		if err := rows.Scan(&k); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		keys = append(keys, k)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, k := range keys {
+		if err := deleteSession(tx, k); err != nil {
+			return 0, err
+		}
+	}
+	return len(keys), tx.Commit()
+}
+
+func deleteSession(tx *sql.Tx, sessionKey string) error {
+	if _, err := tx.Exec("DELETE FROM chunks WHERE session_key = ?", sessionKey); err != nil {
 		return err
 	}
-	return tx.Commit()
+	_, err := tx.Exec("DELETE FROM sessions WHERE session_key = ?", sessionKey)
+	return err
 }
 
 func (d *DB) SessionCount() (int, error) {
@@ -180,28 +307,79 @@ func (d *DB) ChunkCount() (int, error) {
 }
 
 func (d *DB) GetSessionByKey(sessionKey string) (*SessionRow, error) {
-	var s SessionRow
-	err := d.db.QueryRow(
-		"SELECT session_key, source, file_path, repo_cwd, created_at, updated_at, summary FROM sessions WHERE session_key = ?",
+	return getSession(d.db, sessionKey)
+}
+
+// getSession looks up a session through a *sql.DB or *sql.Tx.
+func getSession(q interface {
+	QueryRow(query string, args ...any) *sql.Row
+}, sessionKey string) (*SessionRow, error) {
+	s, err := scanSession(q.QueryRow(
+		"SELECT "+sessionColumns+" FROM sessions WHERE session_key = ?",
 		sessionKey,
-	).Scan(&s.SessionKey, &s.Source, &s.FilePath, &s.RepoCwd, &s.CreatedAt, &s.UpdatedAt, &s.Summary)
+	))
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
 	if err != nil {
 		return nil, err
 	}
-	return &s, nil
+	return s, nil
+}
+
+// GetSubagents returns the subagent sessions of a parent, oldest first.
+func (d *DB) GetSubagents(parentKey string) ([]SessionRow, error) {
+	rows, err := d.db.Query(
+		"SELECT "+sessionColumns+" FROM sessions WHERE parent_session_key = ? ORDER BY created_at",
+		parentKey,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []SessionRow
+	for rows.Next() {
+		s, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, *s)
+	}
+	return sessions, rows.Err()
 }
 
 type SessionRow struct {
-	SessionKey string
-	Source     string
-	FilePath   string
-	RepoCwd    string
-	CreatedAt  string
-	UpdatedAt  string
-	Summary    string
+	SessionKey       string
+	Source           string
+	FilePath         string
+	RepoCwd          string
+	CreatedAt        string
+	UpdatedAt        string
+	Summary          string
+	ParentSessionKey string
+	GitBranch        string
+	Model            string
+	CLIVersion       string
+	RepoURL          string
+	GitCommit        string
+	Archived         bool   // the log file was deleted; see ArchiveSession
+	Host             string // machine the session ran on, if known
+	Imported         bool   // from a bundle rather than a local log file
+}
+
+const sessionColumns = "session_key, source, file_path, repo_cwd, created_at, updated_at, summary, parent_session_key, git_branch, model, cli_version, repo_url, git_commit, archived, host, imported"
+
+// scanSession scans a row selected with sessionColumns.
+func scanSession(row interface{ Scan(...any) error }) (*SessionRow, error) {
+	var s SessionRow
+	err := row.Scan(&s.SessionKey, &s.Source, &s.FilePath, &s.RepoCwd, &s.CreatedAt, &s.UpdatedAt, &s.Summary,
+		&s.ParentSessionKey, &s.GitBranch, &s.Model, &s.CLIVersion, &s.RepoURL, &s.GitCommit, &s.Archived,
+		&s.Host, &s.Imported)
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
 }
 
 type ChunkRow struct {
@@ -210,13 +388,37 @@ type ChunkRow struct {
 	Ts         string
 	Role       string
 	Kind       string
+	Tool       string
 	Text       string
 	LineNumber int
+	MsgID      int // ChunkID of the first sub-chunk of the message
+	MsgOffset  int // byte offset of Text within the message
+
+	UUID         string
+	ParentUUID   string
+	Model        string
+	InputTokens  int
+	OutputTokens int
+}
+
+const chunkColumns = "session_key, chunk_id, ts, role, kind, tool, text, line_number, msg_id, msg_offset, uuid, parent_uuid, model, input_tokens, output_tokens"
+
+func scanChunk(rows *sql.Rows) (ChunkRow, error) {
+	var c ChunkRow
+	err := rows.Scan(&c.SessionKey, &c.ChunkID, &c.Ts, &c.Role, &c.Kind, &c.Tool, &c.Text, &c.LineNumber, &c.MsgID, &c.MsgOffset,
+		&c.UUID, &c.ParentUUID, &c.Model, &c.InputTokens, &c.OutputTokens)
+	return c, err
 }
 
 func (d *DB) GetChunks(sessionKey string) ([]ChunkRow, error) {
-	rows, err := d.db.Query(
-		"SELECT session_key, chunk_id, ts, role, kind, text, line_number FROM chunks WHERE session_key = ? ORDER BY chunk_id",
+	return getChunks(d.db, sessionKey)
+}
+
+func getChunks(q interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+}, sessionKey string) ([]ChunkRow, error) {
+	rows, err := q.Query(
+		"SELECT "+chunkColumns+" FROM chunks WHERE session_key = ? ORDER BY chunk_id",
 		sessionKey,
 	)
 	if err != nil {
@@ -226,8 +428,8 @@ func (d *DB) GetChunks(sessionKey string) ([]ChunkRow, error) {
 
 	var chunks []ChunkRow
 	for rows.Next() {
-		var c ChunkRow
-		if err := rows.Scan(&c.SessionKey, &c.ChunkID, &c.Ts, &c.Role, &c.Kind, &c.Text, &c.LineNumber); err != nil {
+		c, err := scanChunk(rows)
+		if err != nil {
 			return nil, err
 		}
 		chunks = append(chunks, c)
@@ -235,28 +437,32 @@ func (d *DB) GetChunks(sessionKey string) ([]ChunkRow, error) {
 	return chunks, rows.Err()
 }
 
-// GetChunksWindow returns a window of chunks around a hit chunk.
+// GetChunksWindow returns a window of messages around a hit chunk.
 // It only loads the necessary rows from the database instead of all chunks.
-// startPos is the number of chunks before the returned window.
-// totalCount is the total number of chunks in the session.
-func (d *DB) GetChunksWindow(sessionKey string, hitChunkID, context int) (chunks []ChunkRow, hitIdx int, startPos int, totalCount int, err error) {
-	// get total count
-	err = d.db.QueryRow(
-		"SELECT COUNT(*) FROM chunks WHERE session_key = ?", sessionKey,
+// The window is counted in messages, and every sub-chunk of a message in the
+// window is returned, so callers can reassemble long messages.
+// hitIdx is the index of the hit chunk in the returned slice.
+// startPos is the number of messages before the returned window.
+// totalCount is the total number of messages in the session.
+// The queries are abandoned when ctx is cancelled.
+func (d *DB) GetChunksWindow(ctx context.Context, sessionKey string, hitChunkID, contextSize int) (chunks []ChunkRow, hitIdx int, startPos int, totalCount int, err error) {
+	// get total message count
+	err = d.db.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM chunks WHERE session_key = ? AND msg_offset = 0", sessionKey,
 	).Scan(&totalCount)
 	if err != nil {
 		return nil, -1, 0, 0, err
 	}
 
-	// find the row_number (0-based position) of the hit chunk
+	// find the 0-based message position of the message containing the hit chunk
 	hitPos := -1
 	if hitChunkID >= 0 {
-		err = d.db.QueryRow(`
+		err = d.db.QueryRowContext(ctx, `
 			SELECT pos FROM (
 				SELECT chunk_id, ROW_NUMBER() OVER (ORDER BY chunk_id) - 1 AS pos
-				FROM chunks WHERE session_key = ?
-			) WHERE chunk_id = ?`,
-			sessionKey, hitChunkID,
+				FROM chunks WHERE session_key = ? AND msg_offset = 0
+			) WHERE chunk_id = (SELECT msg_id FROM chunks WHERE session_key = ? AND chunk_id = ?)`,
+			sessionKey, sessionKey, hitChunkID,
 		).Scan(&hitPos)
 		if err == sql.ErrNoRows {
 			hitPos = -1
@@ -270,20 +476,26 @@ func (d *DB) GetChunksWindow(sessionKey string, hitChunkID, context int) (chunks
 	startPos = 0
 	limit := totalCount
 	if hitPos >= 0 {
-		startPos = hitPos - context
+		startPos = hitPos - contextSize
 		if startPos < 0 {
 			startPos = 0
 		}
-		endPos := hitPos + context + 1
+		endPos := hitPos + contextSize + 1
 		if endPos > totalCount {
 			endPos = totalCount
 		}
 		limit = endPos - startPos
 	}
 
-	rows, err := d.db.Query(
-		"SELECT session_key, chunk_id, ts, role, kind, text, line_number FROM chunks WHERE session_key = ? ORDER BY chunk_id LIMIT ? OFFSET ?",
-		sessionKey, limit, startPos,
+	// load every sub-chunk of the messages in the window
+	rows, err := d.db.QueryContext(ctx, `
+		SELECT `+chunkColumns+` FROM chunks
+		WHERE session_key = ? AND msg_id IN (
+			SELECT chunk_id FROM chunks WHERE session_key = ? AND msg_offset = 0
+			ORDER BY chunk_id LIMIT ? OFFSET ?
+		)
+		ORDER BY chunk_id`,
+		sessionKey, sessionKey, limit, startPos,
 	)
 	if err != nil {
 		return nil, -1, 0, 0, err
@@ -293,8 +505,8 @@ func (d *DB) GetChunksWindow(sessionKey string, hitChunkID, context int) (chunks
 	var result []ChunkRow
 	localHitIdx := -1
 	for rows.Next() {
-		var c ChunkRow
-		if err := rows.Scan(&c.SessionKey, &c.ChunkID, &c.Ts, &c.Role, &c.Kind, &c.Text, &c.LineNumber); err != nil {
+		c, err := scanChunk(rows)
+		if err != nil {
 			return nil, -1, 0, 0, err
 		}
 		if c.ChunkID == hitChunkID {
@@ -0,0 +1,91 @@
+package index
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/Zuo-Peng/ai-session-search/internal/parse"
+)
+
+// ImportResult is what ImportSession did with a session.
+type ImportResult int
+
+const (
+	ImportAdded     ImportResult = iota // not in the index before
+	ImportUpdated                       // replaced an older import of it
+	ImportDuplicate                     // already indexed with the same content
+	ImportConflict                      // a local session has the key; kept
+)
+
+// ContentHash identifies the content of a session's chunks, so the same
+// session arriving from two places can be recognised.
+func ContentHash(chunks []ChunkRow) string {
+	h := sha256.New()
+	for _, c := range chunks {
+		fmt.Fprintf(h, "%d\x00%s\x00%s\x00%s\x00%s\x00%s\x00", c.ChunkID, c.Ts, c.Role, c.Kind, c.Tool, c.Text)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// ImportSession merges a session from another machine into the index, marked
+// imported and tagged with its host. A session already indexed with the same
+// content is left alone, as is one indexed from a local file: local logs are
+// authoritative. An earlier import of it is replaced.
+func (d *DB) ImportSession(s SessionRow, chunks []ChunkRow) (ImportResult, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	result := ImportAdded
+	prev, err := getSession(tx, s.SessionKey)
+	if err != nil {
+		return 0, err
+	}
+	if prev != nil {
+		prevChunks, err := getChunks(tx, s.SessionKey)
+		if err != nil {
+			return 0, err
+		}
+		switch {
+		case ContentHash(prevChunks) == ContentHash(chunks):
+			return ImportDuplicate, nil
+		case !prev.Imported:
+			return ImportConflict, nil
+		}
+		if err := deleteSession(tx, s.SessionKey); err != nil {
+			return 0, err
+		}
+		result = ImportUpdated
+	}
+
+	_, err = tx.Exec(
+		`INSERT INTO sessions (session_key, source, file_path, repo_cwd, created_at, updated_at, summary, parent_session_key,
+		     git_branch, model, cli_version, repo_url, git_commit, host, imported)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, 1)`,
+		s.SessionKey, s.Source, s.FilePath, s.RepoCwd, s.CreatedAt, s.UpdatedAt, s.Summary, s.ParentSessionKey,
+		s.GitBranch, s.Model, s.CLIVersion, s.RepoURL, s.GitCommit, s.Host,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	stmt, err := tx.Prepare(
+		`INSERT INTO chunks (session_key, chunk_id, ts, role, kind, tool, text, line_number, msg_id, msg_offset, uuid, parent_uuid, model, input_tokens, output_tokens, subwords)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+	)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+	for _, c := range chunks {
+		_, err := stmt.Exec(s.SessionKey, c.ChunkID, c.Ts, c.Role, c.Kind, c.Tool, c.Text, c.LineNumber, c.MsgID, c.MsgOffset,
+			c.UUID, c.ParentUUID, c.Model, c.InputTokens, c.OutputTokens, parse.Subwords(c.Text))
+		if err != nil {
+			return 0, err
+		}
+	}
+	return result, tx.Commit()
+}
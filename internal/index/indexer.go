@@ -1,10 +1,21 @@
 package index
 
 import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
 
+	"github.com/Zuo-Peng/ai-session-search/internal/config"
 	"github.com/Zuo-Peng/ai-session-search/internal/parse"
 	"github.com/Zuo-Peng/ai-session-search/internal/scan"
+	"github.com/Zuo-Peng/ai-session-search/internal/source"
 )
 
 type Stats struct {
@@ -12,105 +23,446 @@ type Stats struct {
 	Updated  int
 	Skipped  int
 	Pruned   int
+	Archived int
 	Errors   int
 }
 
 func (s Stats) String() string {
-	return fmt.Sprintf("scanned=%d updated=%d skipped=%d pruned=%d errors=%d",
-		s.Scanned, s.Updated, s.Skipped, s.Pruned, s.Errors)
+	return fmt.Sprintf("scanned=%d updated=%d skipped=%d pruned=%d archived=%d errors=%d",
+		s.Scanned, s.Updated, s.Skipped, s.Pruned, s.Archived, s.Errors)
 }
 
-func IndexAll(db *DB, claudeRoot, codexRoot string) (Stats, error) {
+// indexBatchSize is how many sessions the writer commits per transaction.
+const indexBatchSize = 200
+
+// indexJob is a file that needs (re)parsing. info is its stored indexing
+// state, or nil for a new file.
+type indexJob struct {
+	fi   scan.FileInfo
+	info *SessionInfo
+}
+
+// parsedFile is the outcome of an indexJob.
+type parsedFile struct {
+	indexJob
+	result     *parse.ParseResult
+	appended   bool   // result only holds the lines after info.Cursor
+	prefixHash string // of the parsed prefix, when result has a Cursor
+	err        error
+}
+
+// IndexAll brings the index up to date with the files on disk. Changed files
+// are parsed on GOMAXPROCS workers while a single writer stores the results
+// in batched transactions. progress, if not nil, follows the pass; files
+// that fail are reported to it and counted in Stats.Errors. It fails with a
+// *LockedError while another process is indexing.
+func IndexAll(db *DB, cfg *config.Config, progress Progress) (Stats, error) {
 	var stats Stats
 
-	files, err := scan.ScanRoots(claudeRoot, codexRoot)
+	release, err := db.LockIndex(false)
+	if err != nil {
+		return stats, err
+	}
+	defer release()
+
+	files, err := scan.ScanRoots(cfg)
 	if err != nil {
 		return stats, fmt.Errorf("scan: %w", err)
 	}
 	stats.Scanned = len(files)
 
+	if err := db.beginIndexRun(); err != nil {
+		return stats, fmt.Errorf("mark index run: %w", err)
+	}
+	defer db.endIndexRun()
+
+	infos, err := db.SessionInfos()
+	if err != nil {
+		return stats, fmt.Errorf("load sessions: %w", err)
+	}
+
 	// track which files we see, for pruning
 	seenKeys := make(map[string]struct{})
+	if err := indexFiles(db, files, infos, &stats, seenKeys, progress); err != nil {
+		return stats, err
+	}
+
+	// prune (or archive) sessions whose files no longer exist
+	if err := pruneSessions(db, cfg, seenKeys, &stats); err != nil {
+		return stats, fmt.Errorf("prune: %w", err)
+	}
+
+	return stats, nil
+}
+
+// IndexFiles brings only the given paths up to date, e.g. as reported by a
+// file watcher. Paths that are not logs of any source are ignored, unless
+// they were indexed before and have since been removed. Like IndexAll it
+// needs the index lock and reports to progress.
+func IndexFiles(db *DB, cfg *config.Config, paths []string, progress Progress) (Stats, error) {
+	var stats Stats
+
+	release, err := db.LockIndex(false)
+	if err != nil {
+		return stats, err
+	}
+	defer release()
+
+	if err := db.beginIndexRun(); err != nil {
+		return stats, fmt.Errorf("mark index run: %w", err)
+	}
+	defer db.endIndexRun()
+
+	infos, err := db.SessionInfos()
+	if err != nil {
+		return stats, fmt.Errorf("load sessions: %w", err)
+	}
+
+	var files []scan.FileInfo
+	for _, path := range paths {
+		if fi, ok := scan.Resolve(cfg, path); ok {
+			files = append(files, fi)
+			continue
+		}
+		if info := infos[path]; info != nil {
+			if _, err := os.Stat(path); os.IsNotExist(err) {
+				if err := removeSession(db, cfg, info.SessionKey, &stats); err != nil {
+					return stats, fmt.Errorf("prune: %w", err)
+				}
+			}
+		}
+	}
+	stats.Scanned = len(files)
+
+	err = indexFiles(db, files, infos, &stats, make(map[string]struct{}), progress)
+	return stats, err
+}
 
+// indexFiles re-indexes the files whose stored state is out of date and
+// records the session key of every file it sees in seenKeys.
+func indexFiles(db *DB, files []scan.FileInfo, infos map[string]*SessionInfo, stats *Stats, seenKeys map[string]struct{}, progress Progress) error {
+	// a file found under overlapping roots is only indexed once
+	seenPaths := make(map[string]bool)
+
+	var jobs []indexJob
 	for _, fi := range files {
-		result, err := parseFile(fi, claudeRoot, codexRoot)
-		if err != nil {
-			stats.Errors++
-			fmt.Printf("  WARN: parse %s: %v\n", fi.Path, err)
+		if seenPaths[fi.Path] {
 			continue
 		}
-		if result == nil || len(result.Chunks) == 0 {
+		seenPaths[fi.Path] = true
+
+		info := infos[fi.Path]
+		if !needsUpdate(info, fi) {
+			seenKeys[info.SessionKey] = struct{}{}
+			stats.Skipped++
 			continue
 		}
+		jobs = append(jobs, indexJob{fi: fi, info: info})
+	}
 
-		seenKeys[result.Meta.SessionKey] = struct{}{}
+	progress.emit(Event{Kind: EventScanned, Total: len(jobs)})
+	return writeAll(db, parseAll(jobs), len(jobs), stats, seenKeys, progress)
+}
 
-		needs, err := needsUpdate(db, result.Meta.SessionKey, fi.Mtime, fi.Size)
-		if err != nil {
+func needsUpdate(info *SessionInfo, fi scan.FileInfo) bool {
+	if info == nil {
+		return true // new session
+	}
+	return info.Mtime != fi.Mtime || info.Size != fi.Size
+}
+
+// parseAll parses jobs on GOMAXPROCS workers. The returned channel is closed
+// once every job has been parsed.
+func parseAll(jobs []indexJob) <-chan parsedFile {
+	in := make(chan indexJob)
+	out := make(chan parsedFile)
+
+	var wg sync.WaitGroup
+	for i := 0; i < runtime.GOMAXPROCS(0); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range in {
+				out <- parseJob(j)
+			}
+		}()
+	}
+
+	go func() {
+		for _, j := range jobs {
+			in <- j
+		}
+		close(in)
+		wg.Wait()
+		close(out)
+	}()
+	return out
+}
+
+// parseJob parses a file, only its appended tail when possible.
+func parseJob(j indexJob) parsedFile {
+	p := parsedFile{indexJob: j}
+	src := source.Get(j.fi.Source)
+	if src == nil {
+		p.err = fmt.Errorf("unknown source: %s", j.fi.Source)
+		return p
+	}
+
+	// append-only logs that only grew: parse just the new lines
+	if a, ok := src.(source.Appender); ok && canAppend(j.fi, j.info) {
+		p.result, p.err = a.ParseFrom(j.fi.Path, j.fi.Root, j.info.Cursor)
+		p.appended = true
+	} else {
+		p.result, p.err = src.Parse(j.fi.Path, j.fi.Root)
+	}
+	if p.err == nil && p.result != nil && p.result.Cursor != nil {
+		p.prefixHash, p.err = prefixHash(j.fi.Path, p.result.Cursor.Offset)
+	}
+	if p.err == nil && p.result != nil && j.fi.OtherHost {
+		hostKeys(p.result, j.fi.Host)
+	}
+	return p
+}
+
+// hostKeys prefixes the session keys of another machine's log with its host,
+// so they cannot collide with the same relative path on this one.
+func hostKeys(r *parse.ParseResult, host string) {
+	r.Meta.SessionKey = HostKey(host, r.Meta.SessionKey)
+	if r.Meta.ParentSessionKey != "" {
+		r.Meta.ParentSessionKey = HostKey(host, r.Meta.ParentSessionKey)
+	}
+	for i := range r.Chunks {
+		r.Chunks[i].SessionKey = r.Meta.SessionKey
+	}
+}
+
+// HostKey returns the key a session of another machine is stored under: its
+// own key prefixed with the host, unless it already is. Logs indexed from a
+// [[hosts]] root and sessions imported from a bundle get the same key.
+func HostKey(host, key string) string {
+	prefix := host + "/"
+	if strings.HasPrefix(key, prefix) {
+		return key
+	}
+	return prefix + key
+}
+
+// writeAll stores parsed files as they arrive, committing every
+// indexBatchSize sessions. It always drains parsed.
+func writeAll(db *DB, parsed <-chan parsedFile, total int, stats *Stats, seenKeys map[string]struct{}, progress Progress) error {
+	defer func() {
+		for range parsed {
+		}
+	}()
+
+	var w *batchWriter
+	defer func() {
+		if w != nil {
+			w.tx.Rollback()
+		}
+	}()
+
+	done := 0
+	for p := range parsed {
+		done++
+		// the file still exists: whatever happens to it below, its session
+		// must not be pruned or archived
+		if p.info != nil {
+			seenKeys[p.info.SessionKey] = struct{}{}
+		}
+		if p.err == nil && p.result != nil {
+			seenKeys[p.result.Meta.SessionKey] = struct{}{}
+		}
+		if p.err != nil {
 			stats.Errors++
+			progress.emit(Event{Kind: EventError, Path: p.fi.Path, Err: fmt.Errorf("parse: %w", p.err), Done: done, Total: total})
 			continue
 		}
-		if !needs {
-			stats.Skipped++
+		progress.emit(Event{Kind: EventParsed, Path: p.fi.Path, Done: done, Total: total})
+		if p.result == nil || (!p.appended && len(p.result.Chunks) == 0) {
 			continue
 		}
 
-		if err := indexSession(db, result); err != nil {
+		if w == nil {
+			var err error
+			if w, err = beginBatch(db); err != nil {
+				return fmt.Errorf("begin batch: %w", err)
+			}
+		}
+
+		if _, err := w.write(&p); err != nil {
 			stats.Errors++
-			fmt.Printf("  WARN: index %s: %v\n", fi.Path, err)
+			progress.emit(Event{Kind: EventError, Path: p.fi.Path, Err: fmt.Errorf("index: %w", err), Done: done, Total: total})
 			continue
 		}
 		stats.Updated++
+		progress.emit(Event{Kind: EventWritten, Path: p.fi.Path, Done: done, Total: total})
+
+		if w.n >= indexBatchSize {
+			err := w.tx.Commit()
+			w = nil
+			if err != nil {
+				return fmt.Errorf("commit batch: %w", err)
+			}
+		}
 	}
 
-	// prune sessions whose files no longer exist
-	pruned, err := pruneSessions(db, seenKeys)
+	if w != nil {
+		err := w.tx.Commit()
+		w = nil
+		if err != nil {
+			return fmt.Errorf("commit batch: %w", err)
+		}
+	}
+	return nil
+}
+
+// prefixHashSize is how much of the parsed prefix of a file is hashed, at
+// its start and again just before the cursor, to tell a log that was
+// appended to from one that was rewritten. A rewrite that leaves both of
+// those ends as they were goes unnoticed.
+const prefixHashSize = 4096
+
+// prefixHash hashes the first and the last prefixHashSize bytes of the first
+// n bytes of a file.
+func prefixHash(path string, n int64) (string, error) {
+	f, err := os.Open(path)
 	if err != nil {
-		return stats, fmt.Errorf("prune: %w", err)
+		return "", err
 	}
-	stats.Pruned = pruned
+	defer f.Close()
 
-	return stats, nil
+	h := sha256.New()
+	if _, err := io.CopyN(h, f, min(n, prefixHashSize)); err != nil {
+		return "", err
+	}
+	if n > prefixHashSize {
+		start := max(n-prefixHashSize, prefixHashSize)
+		if _, err := io.CopyN(h, io.NewSectionReader(f, start, n-start), n-start); err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// canAppend reports whether the stored session can be extended by parsing
+// only the tail of the file: it was parsed up to a cursor, the file has not
+// shrunk, and its already-parsed prefix is unchanged.
+func canAppend(fi scan.FileInfo, info *SessionInfo) bool {
+	if info == nil || info.Cursor.Offset == 0 || info.PrefixHash == "" {
+		return false
+	}
+	if fi.Size < info.Size || fi.Size < info.Cursor.Offset {
+		return false
+	}
+	hash, err := prefixHash(fi.Path, info.Cursor.Offset)
+	return err == nil && hash == info.PrefixHash
+}
+
+// sessionMeta converts a stored session back into parse metadata.
+func sessionMeta(s *SessionRow) parse.SessionMeta {
+	return parse.SessionMeta{
+		SessionKey:       s.SessionKey,
+		Source:           s.Source,
+		FilePath:         s.FilePath,
+		ParentSessionKey: s.ParentSessionKey,
+		RepoCwd:          s.RepoCwd,
+		CreatedAt:        parse.Timestamp(s.CreatedAt),
+		UpdatedAt:        parse.Timestamp(s.UpdatedAt),
+		Summary:          s.Summary,
+		Model:            s.Model,
+		GitBranch:        s.GitBranch,
+		Version:          s.CLIVersion,
+		RepoURL:          s.RepoURL,
+		GitCommit:        s.GitCommit,
+	}
+}
+
+// batchWriter writes sessions inside one transaction.
+type batchWriter struct {
+	tx          *sql.Tx
+	insertChunk *sql.Stmt
+	n           int // sessions written
 }
 
-func parseFile(fi scan.FileInfo, claudeRoot, codexRoot string) (*parse.ParseResult, error) {
-	switch fi.Source {
-	case "claude":
-		return parse.ParseClaude(fi.Path, claudeRoot)
-	case "codex":
-		return parse.ParseCodex(fi.Path, codexRoot)
-	default:
-		return nil, fmt.Errorf("unknown source: %s", fi.Source)
+func beginBatch(db *DB) (*batchWriter, error) {
+	tx, err := db.Raw().Begin()
+	if err != nil {
+		return nil, err
+	}
+	stmt, err := tx.Prepare(
+		`INSERT INTO chunks (session_key, chunk_id, ts, role, kind, tool, text, line_number, msg_id, msg_offset, uuid, parent_uuid, model, input_tokens, output_tokens, subwords)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+	)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
 	}
+	return &batchWriter{tx: tx, insertChunk: stmt}, nil
 }
 
-func needsUpdate(db *DB, sessionKey string, mtime, size int64) (bool, error) {
-	info, err := db.GetSessionInfo(sessionKey)
+// write stores one parsed file and returns its session key. A failure only
+// undoes this file's changes, not the rest of the batch.
+func (w *batchWriter) write(p *parsedFile) (string, error) {
+	if _, err := w.tx.Exec("SAVEPOINT session"); err != nil {
+		return "", err
+	}
+	key, err := w.writeSession(p)
 	if err != nil {
-		return false, err
+		w.tx.Exec("ROLLBACK TO session")
+		w.tx.Exec("RELEASE session")
+		return "", err
 	}
-	if info == nil {
-		return true, nil // new session
+	if _, err := w.tx.Exec("RELEASE session"); err != nil {
+		return "", err
 	}
-	return info.Mtime != mtime || info.Size != size, nil
+	w.n++
+	return key, nil
 }
 
-func indexSession(db *DB, result *parse.ParseResult) error {
-	// delete old data first
-	if err := db.DeleteSession(result.Meta.SessionKey); err != nil {
-		return err
+func (w *batchWriter) writeSession(p *parsedFile) (string, error) {
+	result := p.result
+	firstChunkID := 0
+
+	if p.appended {
+		// merge the tail into the stored session and keep its chunks
+		prev, err := getSession(w.tx, p.info.SessionKey)
+		if err != nil {
+			return "", err
+		}
+		if prev == nil {
+			return "", fmt.Errorf("session %s disappeared", p.info.SessionKey)
+		}
+		result.Meta = parse.MergeMeta(sessionMeta(prev), result.Meta)
+		if result.Meta.Summary == "" {
+			result.Meta.Summary = parse.Summarize(result.Chunks)
+		}
+		firstChunkID = p.info.NextChunkID
+	} else if err := deleteSession(w.tx, result.Meta.SessionKey); err != nil {
+		return "", err
 	}
 
-	tx, err := db.Raw().Begin()
-	if err != nil {
-		return err
+	// long messages become several overlapping sub-chunks
+	chunks := parse.SplitChunks(result.Chunks, firstChunkID)
+
+	var cur parse.Cursor
+	var pending string
+	if result.Cursor != nil {
+		cur = *result.Cursor
+		if len(cur.Pending) > 0 {
+			b, err := json.Marshal(cur.Pending)
+			if err != nil {
+				return "", err
+			}
+			pending = string(b)
+		}
 	}
-	defer tx.Rollback()
 
-	// insert session
-	_, err = tx.Exec(
-		`INSERT INTO sessions (session_key, source, file_path, repo_cwd, created_at, updated_at, summary, mtime, size)
-		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+	// insert or replace session
+	_, err := w.tx.Exec(
+		`INSERT OR REPLACE INTO sessions (session_key, source, file_path, repo_cwd, created_at, updated_at, summary, mtime, size, parent_session_key, git_branch, model, cli_version, repo_url, git_commit,
+		     parsed_offset, parsed_lines, next_chunk_id, prefix_hash, pending_tools, host)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 		result.Meta.SessionKey,
 		result.Meta.Source,
 		result.Meta.FilePath,
@@ -120,57 +472,78 @@ func indexSession(db *DB, result *parse.ParseResult) error {
 		result.Meta.Summary,
 		result.Meta.Mtime.Unix(),
 		result.Meta.Size,
+		result.Meta.ParentSessionKey,
+		result.Meta.GitBranch,
+		result.Meta.Model,
+		result.Meta.Version,
+		result.Meta.RepoURL,
+		result.Meta.GitCommit,
+		cur.Offset,
+		cur.Line,
+		firstChunkID+len(chunks),
+		p.prefixHash,
+		pending,
+		p.fi.Host,
 	)
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	// insert chunks
-	stmt, err := tx.Prepare(
-		`INSERT INTO chunks (session_key, chunk_id, ts, role, kind, text, line_number)
-		 VALUES (?, ?, ?, ?, ?, ?, ?)`,
-	)
-	if err != nil {
-		return err
-	}
-	defer stmt.Close()
-
-	for _, c := range result.Chunks {
+	for _, c := range chunks {
 		kind := c.Kind
 		if kind == "" {
 			kind = "text"
 		}
-		_, err := stmt.Exec(
+		_, err := w.insertChunk.Exec(
 			c.SessionKey,
 			c.ChunkID,
 			c.Timestamp.Format("2006-01-02T15:04:05Z"),
 			c.Role,
 			kind,
+			c.Tool,
 			c.Text,
 			c.LineNumber,
+			c.MsgID,
+			c.MsgOffset,
+			c.UUID,
+			c.ParentUUID,
+			c.Model,
+			c.InputTokens,
+			c.OutputTokens,
+			parse.Subwords(c.Text),
 		)
 		if err != nil {
-			return err
+			return "", err
 		}
 	}
 
-	return tx.Commit()
+	return result.Meta.SessionKey, nil
 }
 
-func pruneSessions(db *DB, seenKeys map[string]struct{}) (int, error) {
-	allKeys, err := db.AllSessionKeys()
+func pruneSessions(db *DB, cfg *config.Config, seenKeys map[string]struct{}, stats *Stats) error {
+	liveKeys, err := db.LiveSessionKeys()
 	if err != nil {
-		return 0, err
+		return err
 	}
 
-	pruned := 0
-	for key := range allKeys {
+	for key := range liveKeys {
 		if _, ok := seenKeys[key]; !ok {
-			if err := db.DeleteSession(key); err != nil {
-				return pruned, err
+			if err := removeSession(db, cfg, key, stats); err != nil {
+				return err
 			}
-			pruned++
 		}
 	}
-	return pruned, nil
+	return nil
+}
+
+// removeSession drops a session whose file is gone, or archives it when
+// cfg.Archive is set.
+func removeSession(db *DB, cfg *config.Config, key string, stats *Stats) error {
+	if cfg.Archive {
+		stats.Archived++
+		return db.ArchiveSession(key)
+	}
+	stats.Pruned++
+	return db.DeleteSession(key)
 }
@@ -0,0 +1,228 @@
+package index
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/Zuo-Peng/ai-session-search/internal/config"
+
+	// the logs below are Claude transcripts, which are parsed incrementally
+	_ "github.com/Zuo-Peng/ai-session-search/internal/source/claude"
+)
+
+const (
+	userLine   = `{"type":"user","timestamp":"2026-03-01T10:00:00Z","message":{"role":"user","content":"fix the flaky test"}}` + "\n"
+	callLine   = `{"type":"assistant","timestamp":"2026-03-01T10:00:05Z","message":{"role":"assistant","content":[{"type":"tool_use","id":"t1","name":"Bash","input":{"command":"go test ./..."}}]}}` + "\n"
+	resultLine = `{"type":"user","timestamp":"2026-03-01T10:00:09Z","message":{"role":"user","content":[{"type":"tool_result","tool_use_id":"t1","content":"ok"}]}}` + "\n"
+	replyLine  = `{"type":"assistant","timestamp":"2026-03-01T10:00:12Z","message":{"role":"assistant","content":[{"type":"text","text":"the test passes now"}]}}` + "\n"
+)
+
+// padLine is a record that yields no chunks but pushes the lines after it
+// past the first prefixHashSize bytes.
+var padLine = `{"type":"progress","data":"` + strings.Repeat("x", prefixHashSize) + `"}` + "\n"
+
+// marker replaces the text of a stored chunk, to tell whether a later pass
+// kept the chunk or parsed the file again.
+const marker = "kept from the last pass"
+
+// logFixture is a Claude log under a temporary root and an index for it.
+type logFixture struct {
+	t    *testing.T
+	db   *DB
+	cfg  *config.Config
+	path string
+}
+
+func newLogFixture(t *testing.T) *logFixture {
+	t.Helper()
+	root := t.TempDir()
+	path := filepath.Join(root, "proj", "s1.jsonl")
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	db, err := OpenDB(filepath.Join(t.TempDir(), "ais.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return &logFixture{t: t, db: db, cfg: &config.Config{ClaudeRoot: root}, path: path}
+}
+
+func (f *logFixture) write(data string) {
+	f.t.Helper()
+	if err := os.WriteFile(f.path, []byte(data), 0o644); err != nil {
+		f.t.Fatal(err)
+	}
+}
+
+func (f *logFixture) append(data string) {
+	f.t.Helper()
+	file, err := os.OpenFile(f.path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	defer file.Close()
+	if _, err := file.WriteString(data); err != nil {
+		f.t.Fatal(err)
+	}
+}
+
+func (f *logFixture) index() {
+	f.t.Helper()
+	stats, err := IndexFiles(f.db, f.cfg, []string{f.path}, nil)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	if stats.Updated != 1 || stats.Errors != 0 {
+		f.t.Fatalf("index: %s, want updated=1", stats)
+	}
+}
+
+func (f *logFixture) info() *SessionInfo {
+	f.t.Helper()
+	infos, err := f.db.SessionInfos()
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	info := infos[f.path]
+	if info == nil {
+		f.t.Fatalf("%s is not indexed", f.path)
+	}
+	return info
+}
+
+// mark replaces the text of the first stored chunk with marker.
+func (f *logFixture) mark() {
+	f.t.Helper()
+	if _, err := f.db.Raw().Exec(`UPDATE chunks SET text = ? WHERE session_key = 'claude:proj/s1' AND chunk_id = 0`, marker); err != nil {
+		f.t.Fatal(err)
+	}
+}
+
+type chunk struct {
+	ID         int
+	Kind, Tool string
+}
+
+// chunks returns the stored chunks, and whether the first one is marked.
+func (f *logFixture) chunks() ([]chunk, bool) {
+	f.t.Helper()
+	rows, err := f.db.GetChunks("claude:proj/s1")
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	var chunks []chunk
+	for _, c := range rows {
+		chunks = append(chunks, chunk{c.ChunkID, c.Kind, c.Tool})
+	}
+	return chunks, len(rows) > 0 && rows[0].Text == marker
+}
+
+// TestIndexAppend grows a log in steps and checks that each pass only parses
+// what was appended, picking up where the last one stopped.
+func TestIndexAppend(t *testing.T) {
+	f := newLogFixture(t)
+	f.write(userLine + callLine)
+	f.index()
+	info := f.info()
+	if want := int64(len(userLine + callLine)); info.Cursor.Offset != want || info.Cursor.Line != 2 {
+		t.Errorf("cursor = %d, line %d, want %d, line 2", info.Cursor.Offset, info.Cursor.Line, want)
+	}
+	if want := map[string]string{"t1": "Bash"}; !maps.Equal(info.Cursor.Pending, want) {
+		t.Errorf("pending = %v, want %v", info.Cursor.Pending, want)
+	}
+	if info.NextChunkID != 2 {
+		t.Errorf("next chunk ID = %d, want 2", info.NextChunkID)
+	}
+	f.mark()
+
+	// the result of the pending call, and the start of a line still being
+	// written
+	f.append(resultLine + replyLine[:40])
+	f.index()
+	want := []chunk{{0, "text", ""}, {1, "tool_call", "Bash"}, {2, "tool_result", "Bash"}}
+	if got, kept := f.chunks(); !slices.Equal(got, want) || !kept {
+		t.Errorf("after the result: chunks = %v, kept = %v, want %v, true", got, kept, want)
+	}
+	info = f.info()
+	if want := int64(len(userLine + callLine + resultLine)); info.Cursor.Offset != want || info.Cursor.Line != 3 {
+		t.Errorf("after the result: cursor = %d, line %d, want %d, line 3", info.Cursor.Offset, info.Cursor.Line, want)
+	}
+	if len(info.Cursor.Pending) != 0 {
+		t.Errorf("after the result: pending = %v, want none", info.Cursor.Pending)
+	}
+
+	// the partial line is finished
+	f.append(replyLine[40:])
+	f.index()
+	want = append(want, chunk{3, "text", ""})
+	if got, kept := f.chunks(); !slices.Equal(got, want) || !kept {
+		t.Errorf("after the reply: chunks = %v, kept = %v, want %v, true", got, kept, want)
+	}
+	info = f.info()
+	if want := int64(len(userLine + callLine + resultLine + replyLine)); info.Cursor.Offset != want || info.Cursor.Line != 4 {
+		t.Errorf("after the reply: cursor = %d, line %d, want %d, line 4", info.Cursor.Offset, info.Cursor.Line, want)
+	}
+	if info.NextChunkID != 4 {
+		t.Errorf("after the reply: next chunk ID = %d, want 4", info.NextChunkID)
+	}
+}
+
+// TestIndexReparse changes a log other than by appending to it and checks
+// whether the next pass parses it again from the start.
+func TestIndexReparse(t *testing.T) {
+	tests := []struct {
+		name          string
+		before, after string
+		want          []chunk
+		kept          bool // only the appended lines were parsed
+	}{
+		{
+			name:   "shrunk",
+			before: userLine + callLine + resultLine,
+			after:  userLine,
+			want:   []chunk{{0, "text", ""}},
+		},
+		{
+			name:   "changed start",
+			before: userLine + callLine,
+			after:  strings.Replace(userLine, "flaky", "fuzzy", 1) + callLine + resultLine,
+			want:   []chunk{{0, "text", ""}, {1, "tool_call", "Bash"}, {2, "tool_result", "Bash"}},
+		},
+		{
+			name:   "changed just before the cursor",
+			before: padLine + userLine + callLine,
+			after:  padLine + userLine + strings.Replace(callLine, "go test", "go vet", 1) + resultLine,
+			want:   []chunk{{0, "text", ""}, {1, "tool_call", "Bash"}, {2, "tool_result", "Bash"}},
+		},
+		{
+			name:   "appended after a long prefix",
+			before: padLine + userLine + callLine,
+			after:  padLine + userLine + callLine + resultLine,
+			want:   []chunk{{0, "text", ""}, {1, "tool_call", "Bash"}, {2, "tool_result", "Bash"}},
+			kept:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newLogFixture(t)
+			f.write(tt.before)
+			f.index()
+			f.mark()
+
+			f.write(tt.after)
+			f.index()
+			if got, kept := f.chunks(); !slices.Equal(got, tt.want) || kept != tt.kept {
+				t.Errorf("chunks = %v, kept = %v, want %v, %v", got, kept, tt.want, tt.kept)
+			}
+			info := f.info()
+			if info.Cursor.Offset != int64(len(tt.after)) || info.NextChunkID != len(tt.want) {
+				t.Errorf("cursor = %d, next chunk ID = %d, want %d, %d", info.Cursor.Offset, info.NextChunkID, len(tt.after), len(tt.want))
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package index
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// lockPollInterval is how often LockIndexContext tries a lock held by
+// another process.
+const lockPollInterval = 250 * time.Millisecond
+
+// LockedError is returned when another process holds the index lock.
+type LockedError struct {
+	PID int // holder, 0 if unknown
+}
+
+func (e *LockedError) Error() string {
+	if e.PID == 0 {
+		return "index is being updated by another ais process"
+	}
+	return fmt.Sprintf("index is being updated by another ais process (pid %d)", e.PID)
+}
+
+// lockPath is the advisory lock file next to the database. The lock is an
+// flock on it, so it is released by the kernel if the holder dies; the file
+// holds the holder's pid for messages and ais doctor.
+func lockPath(dbPath string) string {
+	return dbPath + ".lock"
+}
+
+// LockIndex takes the index lock for this DB until release is called. With
+// wait false it fails with a *LockedError if another process holds the lock;
+// otherwise it blocks until the lock is free. A lock this DB already holds
+// is not taken again, and its release is a no-op, so IndexAll can be called
+// under a lock the caller took.
+//
+// The lock belongs to the *DB, not to a goroutine: a second goroutine taking
+// it while the first holds it gets the no-op release and is not kept out.
+// Only one goroutine may write the index through a given *DB, as the TUI's
+// background pass does while the UI only reads; goroutines that write
+// concurrently need a *DB each.
+func (d *DB) LockIndex(wait bool) (release func(), err error) {
+	d.lockMu.Lock()
+	defer d.lockMu.Unlock()
+	if d.lock != nil {
+		return func() {}, nil
+	}
+
+	f, err := os.OpenFile(lockPath(d.path), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open lock: %w", err)
+	}
+	ok, err := flock(f, wait)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("lock: %w", err)
+	}
+	if !ok {
+		pid, _ := readLockPID(f)
+		f.Close()
+		return nil, &LockedError{PID: pid}
+	}
+
+	f.Truncate(0)
+	f.WriteAt([]byte(strconv.Itoa(os.Getpid())), 0)
+	d.lock = f
+
+	return func() {
+		d.lockMu.Lock()
+		defer d.lockMu.Unlock()
+		f.Truncate(0)
+		funlock(f)
+		f.Close()
+		d.lock = nil
+	}, nil
+}
+
+// repairOnOpen makes the writes OpenDB may owe an existing index: the
+// re-index forced by a new schemaVersion and the check after an interrupted
+// run. They are made under the index lock so that they cannot race an
+// indexer; if another process holds it, they are left to a later open.
+func (d *DB) repairOnOpen() error {
+	if !d.schemaOutdated() && !d.interruptedRun() {
+		return nil
+	}
+	release, err := d.LockIndex(false)
+	var locked *LockedError
+	if errors.As(err, &locked) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	d.migrateSchemaVersion()
+	return d.repairInterruptedRun()
+}
+
+// LockIndexContext is LockIndex waiting for the lock, except that it gives up
+// with ctx's error when ctx is done. A blocking flock cannot be interrupted,
+// so it polls instead.
+func (d *DB) LockIndexContext(ctx context.Context) (release func(), err error) {
+	t := time.NewTicker(lockPollInterval)
+	defer t.Stop()
+	for {
+		release, err := d.LockIndex(false)
+		var locked *LockedError
+		if !errors.As(err, &locked) {
+			return release, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// LockStatus reports on the index lock of the database at dbPath: the pid
+// recorded in the lock file, and whether that process still holds the lock.
+// A pid that does not hold it is a stale entry from a process that was
+// killed; the lock itself was released when it died.
+func LockStatus(dbPath string) (pid int, held bool, err error) {
+	f, err := os.OpenFile(lockPath(dbPath), os.O_RDWR, 0)
+	if os.IsNotExist(err) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	defer f.Close()
+
+	pid, _ = readLockPID(f)
+	ok, err := flock(f, false)
+	if err != nil {
+		return pid, false, err
+	}
+	if !ok {
+		return pid, true, nil
+	}
+	funlock(f)
+	return pid, false, nil
+}
+
+func readLockPID(f *os.File) (int, error) {
+	b := make([]byte, 32)
+	n, _ := f.ReadAt(b, 0)
+	return strconv.Atoi(strings.TrimSpace(string(b[:n])))
+}
@@ -0,0 +1,15 @@
+//go:build !unix
+
+package index
+
+import "os"
+
+// flock is a no-op where flock(2) is not available: concurrent ais processes
+// rely on SQLite's busy timeout alone.
+func flock(f *os.File, wait bool) (bool, error) {
+	return true, nil
+}
+
+func funlock(f *os.File) error {
+	return nil
+}
@@ -0,0 +1,334 @@
+package index
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Migration is one numbered step of the index schema.
+type Migration struct {
+	Version int
+	Name    string
+	up      func(tx *sql.Tx) error
+}
+
+// migrations are applied in order, each in its own transaction, and the last
+// applied version is stored in meta as migration_version. Append new steps;
+// never edit or reorder released ones.
+//
+// Databases created before migrations were tracked start at version 0 and
+// have some of the early steps applied already, so steps 1-9 only create or
+// add what is missing.
+var migrations = []Migration{
+	{1, "create sessions, chunks and word index", createBaseSchema},
+	{2, "add chunk tool name", func(tx *sql.Tx) error {
+		return addColumns(tx, "chunks", "tool TEXT NOT NULL DEFAULT ''")
+	}},
+	{3, "add parent session for subagents", func(tx *sql.Tx) error {
+		return addColumns(tx, "sessions", "parent_session_key TEXT NOT NULL DEFAULT ''")
+	}},
+	{4, "add message id and offset for split messages", func(tx *sql.Tx) error {
+		added, err := addColumn(tx, "chunks", "msg_id INTEGER NOT NULL DEFAULT 0")
+		if err != nil {
+			return err
+		}
+		if added {
+			// existing rows are whole messages
+			if _, err := tx.Exec("UPDATE chunks SET msg_id = chunk_id"); err != nil {
+				return err
+			}
+		}
+		return addColumns(tx, "chunks", "msg_offset INTEGER NOT NULL DEFAULT 0")
+	}},
+	{5, "add session and message metadata", func(tx *sql.Tx) error {
+		if err := addColumns(tx, "sessions",
+			"git_branch TEXT NOT NULL DEFAULT ''",
+			"model TEXT NOT NULL DEFAULT ''",
+			"cli_version TEXT NOT NULL DEFAULT ''",
+		); err != nil {
+			return err
+		}
+		return addColumns(tx, "chunks",
+			"uuid TEXT NOT NULL DEFAULT ''",
+			"parent_uuid TEXT NOT NULL DEFAULT ''",
+			"model TEXT NOT NULL DEFAULT ''",
+			"input_tokens INTEGER NOT NULL DEFAULT 0",
+			"output_tokens INTEGER NOT NULL DEFAULT 0",
+		)
+	}},
+	{6, "add git remote and commit", func(tx *sql.Tx) error {
+		return addColumns(tx, "sessions",
+			"repo_url TEXT NOT NULL DEFAULT ''",
+			"git_commit TEXT NOT NULL DEFAULT ''",
+		)
+	}},
+	{7, "add incremental parse state", func(tx *sql.Tx) error {
+		return addColumns(tx, "sessions",
+			"parsed_offset INTEGER NOT NULL DEFAULT 0",
+			"parsed_lines INTEGER NOT NULL DEFAULT 0",
+			"next_chunk_id INTEGER NOT NULL DEFAULT 0",
+			"prefix_hash TEXT NOT NULL DEFAULT ''",
+			"pending_tools TEXT NOT NULL DEFAULT ''",
+		)
+	}},
+	{8, "add trigram index", createTrigramIndex},
+	{9, "add identifier sub-words to word index", addSubwords},
+	{10, "add archived sessions", func(tx *sql.Tx) error {
+		return addColumns(tx, "sessions", "archived INTEGER NOT NULL DEFAULT 0")
+	}},
+	{11, "add host and imported sessions", func(tx *sql.Tx) error {
+		return addColumns(tx, "sessions",
+			"host TEXT NOT NULL DEFAULT ''",
+			"imported INTEGER NOT NULL DEFAULT 0",
+		)
+	}},
+}
+
+// PendingMigrations reports the migration version of the database at dbPath
+// and the migrations OpenDB would apply to it, without changing anything.
+func PendingMigrations(dbPath string) (int, []Migration, error) {
+	if _, err := os.Stat(dbPath); os.IsNotExist(err) {
+		return 0, migrations, nil
+	}
+	db, err := sql.Open("sqlite", "file:"+dbPath+"?mode=ro")
+	if err != nil {
+		return 0, nil, fmt.Errorf("open db: %w", err)
+	}
+	defer db.Close()
+
+	cur, err := migrationVersion(db)
+	if err != nil {
+		return 0, nil, err
+	}
+	if cur > len(migrations) {
+		return cur, nil, newerDBError(cur)
+	}
+	return cur, migrations[cur:], nil
+}
+
+// migrate applies the migrations the database has not had yet.
+func migrate(db *sql.DB) error {
+	if _, err := db.Exec("CREATE TABLE IF NOT EXISTS meta (key TEXT PRIMARY KEY, value TEXT)"); err != nil {
+		return err
+	}
+	cur, err := migrationVersion(db)
+	if err != nil {
+		return err
+	}
+	if cur > len(migrations) {
+		return newerDBError(cur)
+	}
+
+	for _, m := range migrations[cur:] {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if err := m.up(tx); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d (%s): %w", m.Version, m.Name, err)
+		}
+		if _, err := tx.Exec("INSERT OR REPLACE INTO meta (key, value) VALUES ('migration_version', ?)",
+			strconv.Itoa(m.Version)); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("migration %d (%s): %w", m.Version, m.Name, err)
+		}
+	}
+	return nil
+}
+
+// migrationVersion returns the last applied migration, 0 for a new database
+// or one from before migrations were tracked.
+func migrationVersion(db *sql.DB) (int, error) {
+	var hasMeta int
+	if err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE name = 'meta'").Scan(&hasMeta); err != nil {
+		return 0, err
+	}
+	if hasMeta == 0 {
+		return 0, nil
+	}
+	var v string
+	err := db.QueryRow("SELECT value FROM meta WHERE key = 'migration_version'").Scan(&v)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("bad migration_version %q", v)
+	}
+	return n, nil
+}
+
+func newerDBError(version int) error {
+	return fmt.Errorf("database is at migration %d but this ais only knows %d; upgrade ais or remove the database to rebuild it",
+		version, len(migrations))
+}
+
+// addColumns adds each "name TYPE ..." column to table unless it exists.
+func addColumns(tx *sql.Tx, table string, columns ...string) error {
+	for _, col := range columns {
+		if _, err := addColumn(tx, table, col); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addColumn adds the column and reports whether it was missing.
+func addColumn(tx *sql.Tx, table, column string) (bool, error) {
+	name, _, _ := strings.Cut(column, " ")
+	var n int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?", table, name).Scan(&n); err != nil {
+		return false, err
+	}
+	if n > 0 {
+		return false, nil
+	}
+	_, err := tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s", table, column))
+	return err == nil, err
+}
+
+func createBaseSchema(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+CREATE TABLE IF NOT EXISTS sessions (
+    session_key TEXT PRIMARY KEY,
+    source      TEXT NOT NULL,
+    file_path   TEXT NOT NULL,
+    repo_cwd    TEXT NOT NULL DEFAULT '',
+    created_at  TEXT NOT NULL DEFAULT '',
+    updated_at  TEXT NOT NULL DEFAULT '',
+    summary     TEXT NOT NULL DEFAULT '',
+    mtime       INTEGER NOT NULL DEFAULT 0,
+    size        INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS chunks (
+    session_key TEXT NOT NULL,
+    chunk_id    INTEGER NOT NULL,
+    ts          TEXT NOT NULL DEFAULT '',
+    role        TEXT NOT NULL,
+    kind        TEXT NOT NULL DEFAULT 'text',
+    text        TEXT NOT NULL,
+    line_number INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (session_key, chunk_id)
+);
+
+CREATE VIRTUAL TABLE IF NOT EXISTS chunks_fts USING fts5(
+    text,
+    content=chunks,
+    content_rowid=rowid,
+    tokenize='unicode61'
+);
+
+-- triggers to keep FTS in sync
+CREATE TRIGGER IF NOT EXISTS chunks_ai AFTER INSERT ON chunks BEGIN
+    INSERT INTO chunks_fts(rowid, text) VALUES (new.rowid, new.text);
+END;
+
+CREATE TRIGGER IF NOT EXISTS chunks_ad AFTER DELETE ON chunks BEGIN
+    INSERT INTO chunks_fts(chunks_fts, rowid, text) VALUES('delete', old.rowid, old.text);
+END;
+
+CREATE TRIGGER IF NOT EXISTS chunks_au AFTER UPDATE ON chunks BEGIN
+    INSERT INTO chunks_fts(chunks_fts, rowid, text) VALUES('delete', old.rowid, old.text);
+    INSERT INTO chunks_fts(rowid, text) VALUES (new.rowid, new.text);
+END;
+`)
+	if err != nil {
+		return err
+	}
+	// databases from before the kind column
+	return addColumns(tx, "chunks", "kind TEXT NOT NULL DEFAULT 'text'")
+}
+
+// createTrigramIndex adds the index for CJK and substring search and fills
+// it from the existing chunks.
+func createTrigramIndex(tx *sql.Tx) error {
+	var exists int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE name = 'chunks_trigram'").Scan(&exists); err != nil {
+		return err
+	}
+	if exists > 0 {
+		return nil
+	}
+	_, err := tx.Exec(`
+CREATE VIRTUAL TABLE chunks_trigram USING fts5(
+    text,
+    content=chunks,
+    content_rowid=rowid,
+    tokenize='trigram'
+);
+
+CREATE TRIGGER IF NOT EXISTS chunks_trigram_ai AFTER INSERT ON chunks BEGIN
+    INSERT INTO chunks_trigram(rowid, text) VALUES (new.rowid, new.text);
+END;
+
+CREATE TRIGGER IF NOT EXISTS chunks_trigram_ad AFTER DELETE ON chunks BEGIN
+    INSERT INTO chunks_trigram(chunks_trigram, rowid, text) VALUES('delete', old.rowid, old.text);
+END;
+
+CREATE TRIGGER IF NOT EXISTS chunks_trigram_au AFTER UPDATE ON chunks BEGIN
+    INSERT INTO chunks_trigram(chunks_trigram, rowid, text) VALUES('delete', old.rowid, old.text);
+    INSERT INTO chunks_trigram(rowid, text) VALUES (new.rowid, new.text);
+END;
+
+INSERT INTO chunks_trigram(chunks_trigram) VALUES('rebuild');
+`)
+	return err
+}
+
+// addSubwords adds chunks.subwords (see parse.Subwords) and recreates the
+// word index with it as a second column, since FTS5 tables cannot be
+// altered. Existing rows get their sub-words from the re-index that the
+// schemaVersion bump forced alongside this step.
+func addSubwords(tx *sql.Tx) error {
+	if err := addColumns(tx, "chunks", "subwords TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	var ftsSQL string
+	if err := tx.QueryRow("SELECT sql FROM sqlite_master WHERE name = 'chunks_fts'").Scan(&ftsSQL); err != nil {
+		return err
+	}
+	if strings.Contains(ftsSQL, "subwords") {
+		return nil
+	}
+	_, err := tx.Exec(`
+DROP TRIGGER IF EXISTS chunks_ai;
+DROP TRIGGER IF EXISTS chunks_ad;
+DROP TRIGGER IF EXISTS chunks_au;
+DROP TABLE chunks_fts;
+
+CREATE VIRTUAL TABLE chunks_fts USING fts5(
+    text,
+    subwords,
+    content=chunks,
+    content_rowid=rowid,
+    tokenize='unicode61'
+);
+
+CREATE TRIGGER chunks_ai AFTER INSERT ON chunks BEGIN
+    INSERT INTO chunks_fts(rowid, text, subwords) VALUES (new.rowid, new.text, new.subwords);
+END;
+
+CREATE TRIGGER chunks_ad AFTER DELETE ON chunks BEGIN
+    INSERT INTO chunks_fts(chunks_fts, rowid, text, subwords) VALUES('delete', old.rowid, old.text, old.subwords);
+END;
+
+CREATE TRIGGER chunks_au AFTER UPDATE ON chunks BEGIN
+    INSERT INTO chunks_fts(chunks_fts, rowid, text, subwords) VALUES('delete', old.rowid, old.text, old.subwords);
+    INSERT INTO chunks_fts(rowid, text, subwords) VALUES (new.rowid, new.text, new.subwords);
+END;
+
+INSERT INTO chunks_fts(chunks_fts) VALUES('rebuild');
+`)
+	return err
+}
@@ -0,0 +1,43 @@
+package index
+
+import "fmt"
+
+// EventKind says what an indexing Event reports.
+type EventKind int
+
+const (
+	EventScanned EventKind = iota // the roots were scanned; Total files need indexing
+	EventParsed                   // Path was parsed
+	EventWritten                  // Path was stored in the index
+	EventError                    // Path could not be indexed; see Err
+)
+
+// Event reports the progress of an index pass.
+type Event struct {
+	Kind  EventKind
+	Path  string
+	Err   error
+	Done  int // files handled so far, out of
+	Total int // the files that need (re)indexing
+}
+
+func (e Event) String() string {
+	switch e.Kind {
+	case EventScanned:
+		return fmt.Sprintf("%d files to index", e.Total)
+	case EventError:
+		return fmt.Sprintf("%s: %v", e.Path, e.Err)
+	}
+	return fmt.Sprintf("%d/%d %s", e.Done, e.Total, e.Path)
+}
+
+// Progress receives the events of an index pass. It is called on the
+// goroutine running the pass and should return quickly; a nil Progress
+// ignores them.
+type Progress func(Event)
+
+func (p Progress) emit(e Event) {
+	if p != nil {
+		p(e)
+	}
+}
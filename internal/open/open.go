@@ -19,6 +19,10 @@ func OpenSession(db *index.DB, sessionKey string, hitChunkID int) error {
 		return fmt.Errorf("session not found: %s", sessionKey)
 	}
 
+	if session.Archived {
+		return fmt.Errorf("session %s is archived: %s was deleted", sessionKey, session.FilePath)
+	}
+
 	filePath := session.FilePath
 	if _, err := os.Stat(filePath); err != nil {
 		return fmt.Errorf("file not found: %s", filePath)
@@ -30,7 +34,7 @@ func OpenSession(db *index.DB, sessionKey string, hitChunkID int) error {
 		chunks, err := db.GetChunks(sessionKey)
 		if err == nil {
 			for _, c := range chunks {
-				if c.ChunkID == hitChunkID {
+				if c.ChunkID == hitChunkID && c.LineNumber > 0 {
 					lineNum = c.LineNumber
 					break
 				}
@@ -0,0 +1,88 @@
+package parse
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// Cursor marks how far an append-only log has been parsed, so that a later
+// parse can start at the first line written since.
+type Cursor struct {
+	Offset int64 // byte offset just past the last consumed line
+	Line   int   // number of lines consumed
+
+	// Pending maps the IDs of tool calls that have no result yet to the
+	// tool name, so results in the appended data are still labelled.
+	Pending map[string]string
+}
+
+// NewLineScanner returns a scanner over the lines of r with the MaxLineSize
+// limit. After each Scan, *offset has advanced past the returned line and its
+// newline.
+func NewLineScanner(r io.Reader, offset *int64) *bufio.Scanner {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), MaxLineSize)
+	scanner.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		advance, token, err := bufio.ScanLines(data, atEOF)
+		*offset += int64(advance)
+		return advance, token, err
+	})
+	return scanner
+}
+
+// MergeMeta folds the metadata of an appended tail into the metadata of the
+// part parsed before. Fields fixed at session start keep their first value;
+// list fields are unioned; the rest take the newer value when it is set.
+func MergeMeta(prev, tail SessionMeta) SessionMeta {
+	m := tail
+	if prev.RepoCwd != "" {
+		m.RepoCwd = prev.RepoCwd
+	}
+	if prev.ParentSessionKey != "" {
+		m.ParentSessionKey = prev.ParentSessionKey
+	}
+	if !prev.CreatedAt.IsZero() {
+		m.CreatedAt = prev.CreatedAt
+	}
+	if m.UpdatedAt.IsZero() {
+		m.UpdatedAt = prev.UpdatedAt
+	}
+	if m.Summary == "" {
+		m.Summary = prev.Summary
+	}
+	if m.Version == "" {
+		m.Version = prev.Version
+	}
+	if prev.RepoURL != "" {
+		m.RepoURL = prev.RepoURL
+		m.GitCommit = prev.GitCommit
+	}
+	m.Model = unionList(prev.Model, tail.Model)
+	m.GitBranch = unionList(prev.GitBranch, tail.GitBranch)
+	return m
+}
+
+// unionList joins the distinct entries of two ListSep-joined lists.
+func unionList(a, b string) string {
+	if a == "" {
+		return b
+	}
+	out := strings.Split(a, ListSep)
+	for _, v := range strings.Split(b, ListSep) {
+		if v == "" {
+			continue
+		}
+		found := false
+		for _, have := range out {
+			if have == v {
+				found = true
+				break
+			}
+		}
+		if !found {
+			out = append(out, v)
+		}
+	}
+	return strings.Join(out, ListSep)
+}
@@ -0,0 +1,33 @@
+package parse
+
+import "strings"
+
+// NormalizeRepoURL reduces a git remote URL to "host/owner/repo" so that
+// the https, ssh and scp-style forms of the same remote compare equal.
+func NormalizeRepoURL(u string) string {
+	u = strings.TrimSpace(u)
+	if u == "" {
+		return ""
+	}
+
+	if i := strings.Index(u, "://"); i >= 0 {
+		u = u[i+3:]
+	} else if i := strings.Index(u, ":"); i >= 0 && !strings.Contains(u[:i], "/") {
+		// scp-style git@host:owner/repo
+		u = u[:i] + "/" + u[i+1:]
+	}
+	if i := strings.Index(u, "@"); i >= 0 && i < strings.Index(u+"/", "/") {
+		u = u[i+1:] // drop user info
+	}
+
+	u = strings.TrimSuffix(strings.TrimRight(u, "/"), ".git")
+	host, path, _ := strings.Cut(u, "/")
+	host = strings.ToLower(host)
+	if h, port, ok := strings.Cut(host, ":"); ok && (port == "22" || port == "443") {
+		host = h
+	}
+	if path == "" {
+		return host
+	}
+	return host + "/" + path
+}
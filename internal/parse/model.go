@@ -3,28 +3,55 @@ package parse
 import "time"
 
 type SessionMeta struct {
-	SessionKey string
-	Source     string // "claude" or "codex"
-	FilePath   string
-	RepoCwd    string
-	CreatedAt  time.Time
-	UpdatedAt  time.Time
-	Summary    string
-	Mtime      time.Time
-	Size       int64
+	SessionKey       string
+	Source           string // "claude" or "codex"
+	FilePath         string
+	ParentSessionKey string // set for subagent transcripts
+	RepoCwd          string
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+	Summary          string
+	Mtime            time.Time
+	Size             int64
+
+	// Model and GitBranch list every distinct value seen in the session,
+	// joined with ListSep.
+	Model     string
+	GitBranch string
+	Version   string // agent CLI version
+
+	RepoURL   string // normalized git remote, see NormalizeRepoURL
+	GitCommit string // HEAD commit when the session started
 }
 
+// ListSep joins multi-valued session fields such as Model and GitBranch.
+const ListSep = ", "
+
 type Chunk struct {
 	SessionKey string
 	ChunkID    int
 	Timestamp  time.Time
-	Role       string // "user" or "assistant"
-	Kind       string // "text" or "thinking"
+	Role       string // "user", "assistant" or "tool"
+	Kind       string // "text", "thinking", "tool_call" or "tool_result"
+	Tool       string // tool name for tool_call/tool_result chunks
 	Text       string
 	LineNumber int // line number in original file
+	MsgID      int // ChunkID of the first sub-chunk of the same message
+	MsgOffset  int // byte offset of Text within the whole message
+
+	// per-message metadata, when the source records it
+	UUID         string
+	ParentUUID   string
+	Model        string
+	InputTokens  int
+	OutputTokens int
 }
 
 type ParseResult struct {
 	Meta   SessionMeta
 	Chunks []Chunk
+
+	// Cursor is where parsing stopped, for sources whose logs are
+	// append-only; nil otherwise.
+	Cursor *Cursor
 }
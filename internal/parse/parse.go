@@ -0,0 +1,119 @@
+package parse
+
+import (
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const MaxLineSize = 10 * 1024 * 1024 // 10MB
+const MaxTextSize = 8 * 1024         // 8KB per indexed sub-chunk
+
+// splitOverlap is how many bytes consecutive sub-chunks share, so phrases
+// crossing a split boundary still match.
+const splitOverlap = 512
+
+// SplitChunks splits chunks whose text exceeds MaxTextSize into overlapping
+// sub-chunks and renumbers all chunks from firstID. Every sub-chunk records
+// the ID of the first part of its message in MsgID and its byte position in
+// the original text in MsgOffset, so the message can be reassembled.
+func SplitChunks(chunks []Chunk, firstID int) []Chunk {
+	out := make([]Chunk, 0, len(chunks))
+	id := firstID
+	for _, c := range chunks {
+		msgID := id
+		for _, off := range splitOffsets(c.Text) {
+			part := c
+			part.ChunkID = id
+			part.MsgID = msgID
+			part.MsgOffset = off.start
+			part.Text = c.Text[off.start:off.end]
+			out = append(out, part)
+			id++
+		}
+	}
+	return out
+}
+
+type span struct{ start, end int }
+
+// splitOffsets returns the byte ranges of the sub-chunks of text. Ranges end
+// on whitespace when one is available near the limit and never split a valid
+// rune.
+func splitOffsets(text string) []span {
+	if len(text) <= MaxTextSize {
+		return []span{{0, len(text)}}
+	}
+
+	var spans []span
+	start := 0
+	for {
+		end := start + MaxTextSize
+		if end >= len(text) {
+			spans = append(spans, span{start, len(text)})
+			return spans
+		}
+		// prefer breaking after whitespace in the last quarter of the window
+		if ws := strings.LastIndexAny(text[end-MaxTextSize/4:end], " \t\n"); ws >= 0 {
+			end = end - MaxTextSize/4 + ws + 1
+		}
+		end = runeStart(text, end)
+		if end <= start {
+			end = start + MaxTextSize // invalid UTF-8: cut anywhere
+		}
+		spans = append(spans, span{start, end})
+
+		next := runeStart(text, end-splitOverlap)
+		if next <= start {
+			next = end
+		}
+		start = next
+	}
+}
+
+// runeStart moves i back to the start of the rune containing it. In invalid
+// UTF-8 it gives up after utf8.UTFMax bytes and returns i unchanged.
+func runeStart(s string, i int) int {
+	for j := i; j > 0 && j < len(s) && i-j < utf8.UTFMax; j-- {
+		if utf8.RuneStart(s[j]) {
+			return j
+		}
+	}
+	return i
+}
+
+// Summarize derives a session summary from the first plain text chunk.
+func Summarize(chunks []Chunk) string {
+	for _, c := range chunks {
+		if c.Kind != "text" {
+			continue
+		}
+		s := c.Text
+		if len(s) > 200 {
+			s = s[:200]
+		}
+		return strings.ReplaceAll(s, "\n", " ")
+	}
+	return ""
+}
+
+// Timestamp parses the timestamp formats found in agent logs, returning
+// the zero time when none match.
+func Timestamp(s string) time.Time {
+	if s == "" {
+		return time.Time{}
+	}
+	// try RFC3339
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t
+	}
+	// try RFC3339Nano
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t
+	}
+	// try ISO8601 without timezone
+	if t, err := time.Parse("2006-01-02T15:04:05", s); err == nil {
+		return t
+	}
+	return time.Time{}
+}
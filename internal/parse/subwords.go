@@ -0,0 +1,61 @@
+package parse
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Subwords returns the sub-words of the identifiers and paths in text,
+// lowercased and space-separated, for the code-aware column of the full-text
+// index: the segments of snake_case, kebab-case and dotted names and of
+// paths, and the parts of camelCase and PascalCase words, so
+// internal/index/GetSessionByKey yields "internal index get session by key".
+// Each sub-word is returned once.
+func Subwords(text string) string {
+	seen := make(map[string]bool)
+	var out []string
+	add := func(parts []string) {
+		for _, p := range parts {
+			p = strings.ToLower(p)
+			if !seen[p] {
+				seen[p] = true
+				out = append(out, p)
+			}
+		}
+	}
+	for _, field := range strings.Fields(text) {
+		segments := strings.FieldsFunc(field, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		if len(segments) > 1 && strings.ContainsAny(field, `_-./\`) {
+			add(segments)
+		}
+		for _, s := range segments {
+			if parts := splitCase(s); len(parts) > 1 {
+				add(parts)
+			}
+		}
+	}
+	return strings.Join(out, " ")
+}
+
+// splitCase splits word before each upper-case letter that follows a
+// lower-case letter or digit, and before the last capital of an acronym
+// followed by lower case, so HTTPServer2Go splits as HTTP, Server2, Go.
+func splitCase(word string) []string {
+	runes := []rune(word)
+	var parts []string
+	start := 0
+	for i := 1; i < len(runes); i++ {
+		if !unicode.IsUpper(runes[i]) {
+			continue
+		}
+		prev := runes[i-1]
+		acronymEnd := unicode.IsUpper(prev) && i+1 < len(runes) && unicode.IsLower(runes[i+1])
+		if unicode.IsLower(prev) || unicode.IsDigit(prev) || acronymEnd {
+			parts = append(parts, string(runes[start:i]))
+			start = i
+		}
+	}
+	return append(parts, string(runes[start:]))
+}
@@ -0,0 +1,46 @@
+package parse
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// FormatToolInput renders tool call arguments as "key: value" lines so that
+// commands, paths and patterns are indexed as plain text instead of JSON.
+func FormatToolInput(raw []byte) string {
+	if len(raw) == 0 {
+		return ""
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return strings.TrimSpace(string(raw))
+	}
+
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var lines []string
+	for _, k := range keys {
+		var v string
+		switch val := fields[k].(type) {
+		case string:
+			v = val
+		case nil:
+			continue
+		default:
+			b, err := json.Marshal(val)
+			if err != nil {
+				v = fmt.Sprint(val)
+			} else {
+				v = string(b)
+			}
+		}
+		lines = append(lines, k+": "+v)
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
@@ -1,12 +1,14 @@
 package render
 
 import (
+	"context"
 	"fmt"
 	"strings"
 	"unicode/utf8"
 
 	"github.com/mattn/go-runewidth"
 	"github.com/Zuo-Peng/ai-session-search/internal/index"
+	"github.com/Zuo-Peng/ai-session-search/internal/search"
 )
 
 const (
@@ -14,11 +16,16 @@ const (
 	colorUser     = "\033[1;34m" // bold blue
 	colorAssist   = "\033[1;32m" // bold green
 	colorThink    = "\033[2;35m" // dim magenta for thinking
+	colorTool     = "\033[1;33m" // bold yellow for tool calls
+	colorOutput   = "\033[2;36m" // dim cyan for tool output
 	colorDim      = "\033[2m"
 	colorHit      = "\033[43m"   // yellow background
 	colorBoldRed  = "\033[1;31m" // bold red for keyword highlights
 )
 
+// maxOutputLines caps how many lines of a tool_result are shown unless it is the hit.
+const maxOutputLines = 20
+
 type Options struct {
 	HitChunkID int
 	Context    int    // messages before/after hit to show
@@ -27,22 +34,27 @@ type Options struct {
 	Query      string // search query for keyword highlighting
 }
 
-// fts5Operators are FTS5 operators that should not be highlighted as keywords.
+// fts5Operators are operators that should not be highlighted as keywords in
+// a query that does not parse.
 var fts5Operators = map[string]bool{
 	"AND": true, "OR": true, "NOT": true, "NEAR": true,
 	"and": true, "or": true, "not": true, "near": true,
 }
 
-// highlightKeywords wraps case-insensitive matches of query terms in bold red ANSI codes.
+// highlightKeywords wraps case-insensitive matches of the words and phrases
+// of query in bold red ANSI codes. Filters and excluded terms are skipped.
 func highlightKeywords(text, query string) string {
 	if query == "" {
 		return text
 	}
-	terms := strings.Fields(query)
 	var filtered []string
-	for _, t := range terms {
-		if !fts5Operators[t] {
-			filtered = append(filtered, t)
+	if q, err := search.ParseQuery(query); err == nil {
+		filtered = q.Words()
+	} else {
+		for _, t := range strings.Fields(query) {
+			if !fts5Operators[t] {
+				filtered = append(filtered, t)
+			}
 		}
 	}
 	if len(filtered) == 0 {
@@ -126,9 +138,79 @@ func wrapLine(line string, maxWidth int) []string {
 	return result
 }
 
+// hitMarker is inserted into message text where the hit sub-chunk begins and
+// removed again when the line it lands on is written.
+const hitMarker = "\x00"
+
+// message is a logical message reassembled from its sub-chunks.
+type message struct {
+	index.ChunkRow
+	hitOffset int // byte offset of the hit sub-chunk in Text, -1 if not in this message
+}
+
+// assembleMessages joins consecutive sub-chunks of the same message back into
+// the original text. It returns the index of the message holding hitIdx.
+func assembleMessages(chunks []index.ChunkRow, hitIdx int) ([]message, int) {
+	var msgs []message
+	msgHit := -1
+	for i, c := range chunks {
+		if len(msgs) > 0 && c.MsgOffset > 0 && msgs[len(msgs)-1].MsgID == c.MsgID {
+			m := &msgs[len(msgs)-1]
+			if c.MsgOffset <= len(m.Text) {
+				// sub-chunks overlap; replace the shared tail with the next part
+				m.Text = m.Text[:c.MsgOffset] + c.Text
+			} else {
+				m.Text += c.Text
+			}
+		} else {
+			msgs = append(msgs, message{ChunkRow: c, hitOffset: -1})
+		}
+		if i == hitIdx {
+			msgHit = len(msgs) - 1
+			msgs[msgHit].hitOffset = c.MsgOffset
+		}
+	}
+	return msgs, msgHit
+}
+
+// markHit inserts hitMarker at the start of the word containing offset.
+func markHit(text string, offset int) string {
+	if offset <= 0 || offset > len(text) {
+		return text
+	}
+	pos := strings.LastIndexAny(text[:offset], " \t\n") + 1
+	return text[:pos] + hitMarker + text[pos:]
+}
+
+// toolLabel appends the tool name, if known, to a role label.
+func toolLabel(label, tool string) string {
+	if tool == "" {
+		return label
+	}
+	return label + " " + tool
+}
+
+// truncateLines keeps the first n lines of text and notes how many were dropped.
+func truncateLines(text string, n int) string {
+	lines := strings.Split(text, "\n")
+	if len(lines) <= n {
+		return text
+	}
+	return strings.Join(lines[:n], "\n") + fmt.Sprintf("\n... (%d more lines)", len(lines)-n)
+}
+
+// shortCommit abbreviates a commit hash the way git log --oneline does.
+func shortCommit(hash string) string {
+	if len(hash) > 7 {
+		return hash[:7]
+	}
+	return hash
+}
+
 // RenderConversation renders a conversation and returns the content,
 // the 0-based line number of the hit chunk header (-1 if no hit), and any error.
-func RenderConversation(db *index.DB, sessionKey string, opts Options) (string, int, error) {
+// It stops with ctx's error when ctx is cancelled.
+func RenderConversation(ctx context.Context, db *index.DB, sessionKey string, opts Options) (string, int, error) {
 	if opts.Context == 0 {
 		opts.Context = 10
 	}
@@ -144,7 +226,10 @@ func RenderConversation(db *index.DB, sessionKey string, opts Options) (string,
 		return "", -1, fmt.Errorf("session not found: %s", sessionKey)
 	}
 
-	chunks, hitIdx, startPos, totalCount, err := db.GetChunksWindow(sessionKey, opts.HitChunkID, opts.Context)
+	chunks, hitIdx, startPos, totalCount, err := db.GetChunksWindow(ctx, sessionKey, opts.HitChunkID, opts.Context)
+	if ctx.Err() != nil {
+		return "", -1, ctx.Err()
+	}
 	if err != nil {
 		return "", -1, fmt.Errorf("get chunks: %w", err)
 	}
@@ -153,7 +238,8 @@ func RenderConversation(db *index.DB, sessionKey string, opts Options) (string,
 		return "(empty session)", -1, nil
 	}
 
-	skipAfter := totalCount - startPos - len(chunks)
+	msgs, hitIdx := assembleMessages(chunks, hitIdx)
+	skipAfter := totalCount - startPos - len(msgs)
 
 	var b strings.Builder
 	hitLine := -1
@@ -161,10 +247,15 @@ func RenderConversation(db *index.DB, sessionKey string, opts Options) (string,
 	separator := colorDim + "--------------------------------------------------" + colorReset
 	wrapW := opts.Width
 
-	// helper to track line count; wraps long lines if Width is set
+	// helper to track line count; wraps long lines if Width is set.
+	// A hitMarker moves hitLine to the line it appears on.
 	writeLine := func(s string) {
 		wrapped := wrapLine(s, wrapW)
 		for _, wl := range wrapped {
+			if strings.Contains(wl, hitMarker) {
+				wl = strings.ReplaceAll(wl, hitMarker, "")
+				hitLine = lineCount
+			}
 			b.WriteString(wl)
 			b.WriteString("\n")
 			lineCount++
@@ -173,12 +264,52 @@ func RenderConversation(db *index.DB, sessionKey string, opts Options) (string,
 
 	// header
 	writeLine(fmt.Sprintf("%s--- %s [%s] %s ---%s", colorDim, sessionKey, session.Source, session.RepoCwd, colorReset))
+	if session.ParentSessionKey != "" {
+		writeLine(fmt.Sprintf("%ssubagent of %s%s", colorDim, session.ParentSessionKey, colorReset))
+	}
+	if session.Imported {
+		writeLine(fmt.Sprintf("%simported from %s%s", colorDim, session.Host, colorReset))
+	}
+	if session.Archived {
+		writeLine(fmt.Sprintf("%sarchived: %s was deleted%s", colorDim, session.FilePath, colorReset))
+	}
+	if session.GitBranch != "" {
+		writeLine(fmt.Sprintf("%sbranch: %s%s", colorDim, session.GitBranch, colorReset))
+	}
+	if session.RepoURL != "" {
+		remote := session.RepoURL
+		if session.GitCommit != "" {
+			remote += " @ " + shortCommit(session.GitCommit)
+		}
+		writeLine(fmt.Sprintf("%sremote: %s%s", colorDim, remote, colorReset))
+	}
+	if session.Model != "" {
+		writeLine(fmt.Sprintf("%smodel: %s%s", colorDim, session.Model, colorReset))
+	}
+	subagents, err := db.GetSubagents(sessionKey)
+	if err != nil {
+		return "", -1, fmt.Errorf("get subagents: %w", err)
+	}
+	if len(subagents) > 0 {
+		writeLine(fmt.Sprintf("%ssubagents (%d):%s", colorDim, len(subagents), colorReset))
+		for _, sa := range subagents {
+			summary := strings.ReplaceAll(sa.Summary, "\n", " ")
+			if runewidth.StringWidth(summary) > 80 {
+				summary = runewidth.Truncate(summary, 80, "...")
+			}
+			writeLine(fmt.Sprintf("%s  -> %s  %s%s", colorDim, sa.SessionKey, summary, colorReset))
+		}
+	}
 
 	if startPos > 0 {
 		writeLine(fmt.Sprintf("%s... (%d messages before) ...%s", colorDim, startPos, colorReset))
 	}
 
-	for i, c := range chunks {
+	for i, c := range msgs {
+		// a render nobody waits for any more need not be finished
+		if err := ctx.Err(); err != nil {
+			return "", -1, err
+		}
 		isHit := (i == hitIdx)
 
 		// separator between messages
@@ -193,11 +324,18 @@ func RenderConversation(db *index.DB, sessionKey string, opts Options) (string,
 		var roleColor string
 		var roleLabel string
 		isThinking := c.Kind == "thinking"
-		switch c.Role {
-		case "user":
+		isOutput := c.Kind == "tool_result"
+		switch {
+		case c.Kind == "tool_call":
+			roleColor = colorTool
+			roleLabel = toolLabel("TOOL", c.Tool)
+		case isOutput:
+			roleColor = colorOutput
+			roleLabel = toolLabel("OUTPUT", c.Tool)
+		case c.Role == "user":
 			roleColor = colorUser
 			roleLabel = "USER"
-		case "assistant":
+		case c.Role == "assistant":
 			if isThinking {
 				roleColor = colorThink
 				roleLabel = "THINK"
@@ -217,7 +355,13 @@ func RenderConversation(db *index.DB, sessionKey string, opts Options) (string,
 		}
 
 		text := c.Text
-		if isThinking {
+		if isHit {
+			text = markHit(text, c.hitOffset)
+		}
+		if isOutput && !isHit {
+			text = truncateLines(text, maxOutputLines)
+		}
+		if isThinking || isOutput {
 			text = colorDim + text + colorReset
 		}
 		text = highlightKeywords(text, opts.Query)
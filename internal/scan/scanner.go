@@ -4,59 +4,74 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+
+	"github.com/Zuo-Peng/ai-session-search/internal/config"
+	"github.com/Zuo-Peng/ai-session-search/internal/source"
 )
 
 type FileInfo struct {
 	Path   string
-	Source string // "claude" or "codex"
+	Source string // registered source name, e.g. "claude" or "codex"
+	Root   string // root the file was found under
 	Mtime  int64
 	Size   int64
+
+	// Host is the machine the log belongs to. OtherHost is set for the
+	// roots of config.Config.Hosts rather than this machine's.
+	Host      string
+	OtherHost bool
 }
 
-func ScanRoots(claudeRoot, codexRoot string) ([]FileInfo, error) {
+// ScanRoots walks the roots of every registered source, for this machine and
+// each configured host, and returns the log files they match.
+func ScanRoots(cfg *config.Config) ([]FileInfo, error) {
 	var files []FileInfo
 
-	if claudeRoot != "" {
-		cf, err := scanClaude(claudeRoot)
-		if err != nil && !os.IsNotExist(err) {
-			return nil, err
-		}
-		files = append(files, cf...)
-	}
-
-	if codexRoot != "" {
-		cf, err := scanCodex(codexRoot)
-		if err != nil && !os.IsNotExist(err) {
-			return nil, err
+	for i, hc := range cfg.HostConfigs() {
+		for _, src := range source.All() {
+			for _, root := range src.Roots(hc) {
+				if root == "" {
+					continue
+				}
+				sf, err := scanRoot(src, root)
+				if err != nil && !os.IsNotExist(err) {
+					return nil, err
+				}
+				for j := range sf {
+					sf[j].Host = hc.Host
+					sf[j].OtherHost = i > 0
+				}
+				files = append(files, sf...)
+			}
 		}
-		files = append(files, cf...)
 	}
 
 	return files, nil
 }
 
-func scanClaude(root string) ([]FileInfo, error) {
+func scanRoot(src source.Source, root string) ([]FileInfo, error) {
+	if _, err := os.Stat(root); err != nil {
+		return nil, err
+	}
+
 	var files []FileInfo
 	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return nil // skip unreadable dirs
 		}
 		if info.IsDir() {
-			base := filepath.Base(path)
-			if base == "subagents" {
+			if path != root && !src.Match(path, info) {
 				return filepath.SkipDir
 			}
 			return nil
 		}
-		if filepath.Ext(path) != ".jsonl" {
-			return nil
-		}
-		if strings.Contains(filepath.Base(path), "sessions-index") {
+		if !src.Match(path, info) {
 			return nil
 		}
 		files = append(files, FileInfo{
 			Path:   path,
-			Source: "claude",
+			Source: src.Name(),
+			Root:   root,
 			Mtime:  info.ModTime().Unix(),
 			Size:   info.Size(),
 		})
@@ -65,25 +80,51 @@ func scanClaude(root string) ([]FileInfo, error) {
 	return files, err
 }
 
-func scanCodex(root string) ([]FileInfo, error) {
-	var files []FileInfo
-	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return nil
+// Resolve returns the FileInfo of path if it is a log file that ScanRoots
+// would find, so single files can be indexed as they change.
+func Resolve(cfg *config.Config, path string) (FileInfo, bool) {
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() {
+		return FileInfo{}, false
+	}
+	for i, hc := range cfg.HostConfigs() {
+		for _, src := range source.All() {
+			for _, root := range src.Roots(hc) {
+				if root == "" || !matchUnder(src, root, path, info) {
+					continue
+				}
+				return FileInfo{
+					Path:      path,
+					Source:    src.Name(),
+					Root:      root,
+					Mtime:     info.ModTime().Unix(),
+					Size:      info.Size(),
+					Host:      hc.Host,
+					OtherHost: i > 0,
+				}, true
+			}
 		}
-		if info.IsDir() {
-			return nil
+	}
+	return FileInfo{}, false
+}
+
+// matchUnder reports whether walking root would reach path and match it:
+// path is below root and no directory in between is pruned by src.
+func matchUnder(src source.Source, root, path string, info os.FileInfo) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil || !filepath.IsLocal(rel) {
+		return false
+	}
+	dir := root
+	for _, part := range strings.Split(filepath.Dir(rel), string(filepath.Separator)) {
+		if part == "." {
+			break
 		}
-		if filepath.Ext(path) != ".jsonl" {
-			return nil
+		dir = filepath.Join(dir, part)
+		di, err := os.Stat(dir)
+		if err != nil || !src.Match(dir, di) {
+			return false
 		}
-		files = append(files, FileInfo{
-			Path:   path,
-			Source: "codex",
-			Mtime:  info.ModTime().Unix(),
-			Size:   info.Size(),
-		})
-		return nil
-	})
-	return files, err
+	}
+	return src.Match(path, info)
 }
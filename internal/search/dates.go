@@ -0,0 +1,103 @@
+package search
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// timestampLayout is how the index stores times, in UTC, so that they
+// compare as strings.
+const timestampLayout = "2006-01-02T15:04:05Z"
+
+// hitTime is when a hit was written: its chunk's timestamp, or the
+// session's last update for chunks without one.
+const hitTime = "CASE WHEN c.ts > '0001-01-01T00:00:00Z' THEN c.ts ELSE s.updated_at END"
+
+// ParseAge parses a duration with day ("d") and week ("w") units in addition
+// to those of time.ParseDuration.
+func ParseAge(s string) (time.Duration, error) {
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if n, ok := strings.CutSuffix(s, suffix); ok {
+			v, err := strconv.Atoi(n)
+			if err != nil || v < 0 {
+				return 0, fmt.Errorf("invalid age %q", s)
+			}
+			return time.Duration(v) * unit, nil
+		}
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid age %q", s)
+	}
+	return d, nil
+}
+
+// parseTime parses a time given on the command line or in a query: a date
+// (YYYY-MM-DD, in the local time zone), an RFC 3339 timestamp, an age such
+// as 3d or 2w, "today", "yesterday", or a weekday such as "last monday".
+// A day stands for all of it: from is its start and to the start of the next
+// day. For a point in time from and to are the same.
+func parseTime(expr string, now time.Time) (from, to time.Time, err error) {
+	s := strings.ToLower(strings.TrimSpace(expr))
+	today := startOfDay(now)
+
+	day := func(t time.Time) (time.Time, time.Time, error) {
+		return t, t.AddDate(0, 0, 1), nil
+	}
+	switch s {
+	case "today":
+		return day(today)
+	case "yesterday":
+		return day(today.AddDate(0, 0, -1))
+	}
+	if name, ok := strings.CutPrefix(s, "last "); ok {
+		s = strings.TrimSpace(name)
+	}
+	for wd := time.Sunday; wd <= time.Saturday; wd++ {
+		if s == strings.ToLower(wd.String()) {
+			// the most recent one before today
+			back := (int(today.Weekday()) - int(wd) + 6) % 7
+			return day(today.AddDate(0, 0, -back-1))
+		}
+	}
+
+	if t, err := time.ParseInLocation("2006-01-02", s, now.Location()); err == nil {
+		return day(t)
+	}
+	if t, err := time.Parse(time.RFC3339, strings.ToUpper(s)); err == nil {
+		return t, t, nil
+	}
+	if age, err := ParseAge(s); err == nil {
+		t := now.Add(-age)
+		return t, t, nil
+	}
+	return time.Time{}, time.Time{}, fmt.Errorf("%q is not a date (want e.g. 2026-03-01, 3d, 2w, yesterday or last monday)", expr)
+}
+
+func startOfDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
+
+// resolveDates replaces opts.Since and opts.Until with the stored-time
+// bounds they stand for: Since from the start of its day, Until through the
+// end of it.
+func resolveDates(opts Options, now time.Time) (Options, error) {
+	if opts.Since != "" {
+		from, _, err := parseTime(opts.Since, now)
+		if err != nil {
+			return opts, fmt.Errorf("since: %w", err)
+		}
+		opts.Since = from.UTC().Format(timestampLayout)
+	}
+	if opts.Until != "" {
+		_, to, err := parseTime(opts.Until, now)
+		if err != nil {
+			return opts, fmt.Errorf("until: %w", err)
+		}
+		opts.Until = to.UTC().Format(timestampLayout)
+	}
+	return opts, nil
+}
@@ -0,0 +1,177 @@
+package search
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseAge(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Duration
+	}{
+		{"0d", 0},
+		{"3d", 3 * 24 * time.Hour},
+		{"2w", 14 * 24 * time.Hour},
+		{"12h", 12 * time.Hour},
+		{"90m", 90 * time.Minute},
+		{"1h30m", 90 * time.Minute},
+	}
+	for _, tt := range tests {
+		got, err := ParseAge(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("ParseAge(%q) = %v, %v, want %v", tt.in, got, err, tt.want)
+		}
+	}
+
+	for _, in := range []string{"", "d", "w", "3", "3x", "-3d", "-2h", "1.5d", "3 d", "d3", "3dd", "2026-03-01"} {
+		if got, err := ParseAge(in); err == nil {
+			t.Errorf("ParseAge(%q) = %v, want an error", in, got)
+		}
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	// a Wednesday evening two hours ahead of UTC
+	zone := time.FixedZone("UTC+2", 2*60*60)
+	now := time.Date(2026, 3, 4, 21, 30, 0, 0, zone)
+	day := func(d int) time.Time { return time.Date(2026, 3, d, 0, 0, 0, 0, zone) }
+
+	tests := []struct {
+		in       string
+		from, to time.Time
+	}{
+		{"today", day(4), day(5)},
+		{"yesterday", day(3), day(4)},
+		{" Yesterday ", day(3), day(4)},
+		{"tuesday", day(3), day(4)},
+		{"last monday", day(2), day(3)},
+		{"Last Monday", day(2), day(3)},
+		{"last   sunday", day(1), day(2)},
+		{"wednesday", time.Date(2026, 2, 25, 0, 0, 0, 0, zone), time.Date(2026, 2, 26, 0, 0, 0, 0, zone)}, // a week ago
+		{"thursday", time.Date(2026, 2, 26, 0, 0, 0, 0, zone), time.Date(2026, 2, 27, 0, 0, 0, 0, zone)},
+
+		// dates are local days
+		{"2026-03-01", day(1), day(2)},
+		{"2026-02-28", time.Date(2026, 2, 28, 0, 0, 0, 0, zone), day(1)},
+
+		// timestamps and ages are points in time
+		{"2026-03-01T10:00:00Z", time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC), time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)},
+		{"2026-03-01t10:00:00+02:00", time.Date(2026, 3, 1, 8, 0, 0, 0, time.UTC), time.Date(2026, 3, 1, 8, 0, 0, 0, time.UTC)},
+		{"3d", now.AddDate(0, 0, -3), now.AddDate(0, 0, -3)},
+		{"2w", now.AddDate(0, 0, -14), now.AddDate(0, 0, -14)},
+		{"12h", now.Add(-12 * time.Hour), now.Add(-12 * time.Hour)},
+		{"0d", now, now},
+	}
+	for _, tt := range tests {
+		from, to, err := parseTime(tt.in, now)
+		if err != nil {
+			t.Errorf("parseTime(%q): %v", tt.in, err)
+			continue
+		}
+		if !from.Equal(tt.from) || !to.Equal(tt.to) {
+			t.Errorf("parseTime(%q) = %v, %v, want %v, %v", tt.in, from, to, tt.from, tt.to)
+		}
+	}
+}
+
+func TestParseTimeErrors(t *testing.T) {
+	now := time.Date(2026, 3, 4, 21, 30, 0, 0, time.UTC)
+	for _, in := range []string{
+		"", "junk", "3x", "-3d", "1.5d", "d", "last", "last week", "next monday", "mon",
+		"2026-13-01", "2026-02-30", "2026/03/01", "03/01/2026", "2026-03-01 10:00",
+	} {
+		_, _, err := parseTime(in, now)
+		if err == nil {
+			t.Errorf("parseTime(%q) succeeded, want an error", in)
+			continue
+		}
+		if want := "is not a date (want e.g. 2026-03-01, 3d, 2w, yesterday or last monday)"; !strings.Contains(err.Error(), want) {
+			t.Errorf("parseTime(%q) error = %q, want one containing %q", in, err, want)
+		}
+	}
+}
+
+func TestResolveDates(t *testing.T) {
+	zone := time.FixedZone("UTC+2", 2*60*60)
+	now := time.Date(2026, 3, 4, 21, 30, 0, 0, zone)
+
+	tests := []struct {
+		since, until string
+		from, to     string // stored-time bounds
+	}{
+		{"", "", "", ""},
+		{"2026-03-01", "", "2026-02-28T22:00:00Z", ""},
+		// --until includes its day
+		{"", "2026-03-01", "", "2026-03-01T22:00:00Z"},
+		{"2026-03-01", "2026-03-01", "2026-02-28T22:00:00Z", "2026-03-01T22:00:00Z"},
+		{"", "yesterday", "", "2026-03-03T22:00:00Z"},
+		{"", "today", "", "2026-03-04T22:00:00Z"},
+		{"last monday", "yesterday", "2026-03-01T22:00:00Z", "2026-03-03T22:00:00Z"},
+		// ages are exact either way
+		{"3d", "12h", "2026-03-01T19:30:00Z", "2026-03-04T07:30:00Z"},
+		// stored-time bounds, as after: and before: produce, are kept
+		{"2026-03-01T10:00:00Z", "2026-03-02T00:00:00Z", "2026-03-01T10:00:00Z", "2026-03-02T00:00:00Z"},
+	}
+	for _, tt := range tests {
+		got, err := resolveDates(Options{Since: tt.since, Until: tt.until}, now)
+		if err != nil {
+			t.Errorf("resolveDates(%q, %q): %v", tt.since, tt.until, err)
+			continue
+		}
+		if got.Since != tt.from || got.Until != tt.to {
+			t.Errorf("resolveDates(%q, %q) = %q, %q, want %q, %q", tt.since, tt.until, got.Since, got.Until, tt.from, tt.to)
+		}
+	}
+
+	for _, tt := range []struct{ since, until, want string }{
+		{"3x", "", `since: "3x" is not a date`},
+		{"", "-2w", `until: "-2w" is not a date`},
+		{"yesterday", "junk", `until: "junk" is not a date`},
+	} {
+		_, err := resolveDates(Options{Since: tt.since, Until: tt.until}, now)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("resolveDates(%q, %q) error = %v, want one containing %q", tt.since, tt.until, err, tt.want)
+		}
+	}
+}
+
+// TestQueryDates checks after: and before: against --since and --until: the
+// query's filters win, and before: excludes the day it names.
+func TestQueryDates(t *testing.T) {
+	local := func(y int, m time.Month, d int) string {
+		return time.Date(y, m, d, 0, 0, 0, 0, time.Local).UTC().Format(timestampLayout)
+	}
+
+	tests := []struct {
+		query        string
+		since, until string
+		from, to     string
+	}{
+		{"x after:2026-03-01", "", "", local(2026, 3, 1), ""},
+		{"x after:2026-03-01", "2026-01-01", "", local(2026, 3, 1), ""},
+		{"x before:2026-03-01", "", "", "", local(2026, 3, 1)},
+		{"x before:2026-03-01", "", "2026-06-30", "", local(2026, 3, 1)},
+		{"x after:2026-03-01 before:2026-03-03", "2026-01-01", "2026-06-30", local(2026, 3, 1), local(2026, 3, 3)},
+		// the flags still apply where the query sets no date
+		{"x after:2026-03-01", "", "2026-03-31", local(2026, 3, 1), local(2026, 4, 1)},
+		{"x before:2026-03-01", "2026-02-01", "", local(2026, 2, 1), local(2026, 3, 1)},
+	}
+	for _, tt := range tests {
+		q, err := ParseQuery(tt.query)
+		if err != nil {
+			t.Errorf("ParseQuery(%q): %v", tt.query, err)
+			continue
+		}
+		got, err := resolveDates(q.apply(Options{Since: tt.since, Until: tt.until}), time.Now())
+		if err != nil {
+			t.Errorf("%q with since %q, until %q: %v", tt.query, tt.since, tt.until, err)
+			continue
+		}
+		if got.Since != tt.from || got.Until != tt.to {
+			t.Errorf("%q with since %q, until %q = %q, %q, want %q, %q",
+				tt.query, tt.since, tt.until, got.Since, got.Until, tt.from, tt.to)
+		}
+	}
+}
@@ -0,0 +1,332 @@
+package search
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/Zuo-Peng/ai-session-search/internal/source"
+)
+
+// Query is a parsed search query:
+//
+//	repo:api role:user kind:thinking source:codex after:2026-03-01
+//	before:2026-04-01 "exact phrase" -exclude retry OR backoff
+//
+// Words and "phrases" must all match, except that OR makes the terms on
+// either side alternatives; -term excludes hits containing it and a word
+// ending in * matches as a prefix. field:value pairs filter like the
+// corresponding Options and take precedence over them.
+type Query struct {
+	Groups  [][]Term // all groups must match, any term of a group
+	Exclude []Term
+
+	Repo   string
+	Role   string
+	Kind   string
+	Source string
+	After  string // stored-time bounds, see parseTime
+	Before string
+}
+
+// Term is a word or phrase of a Query.
+type Term struct {
+	Text   string
+	Phrase bool // was quoted
+	Prefix bool // word*
+}
+
+var (
+	roles = []string{"user", "assistant", "tool"}
+	kinds = []string{"text", "thinking", "tool_call", "tool_result"}
+)
+
+// queryFields are the field: prefixes the query language knows. Any other
+// word containing a colon is searched for as it is.
+var queryFields = []string{"repo", "role", "kind", "source", "after", "before"}
+
+// token is a word of the query as written.
+type token struct {
+	text    string
+	field   string // set for field:value
+	exclude bool   // -token
+	quoted  bool
+}
+
+func queryError(format string, args ...any) error {
+	return fmt.Errorf("invalid query: "+format, args...)
+}
+
+// ParseQuery parses a query written in the query language. Its errors are
+// meant to be shown to the user as they are.
+func ParseQuery(s string) (*Query, error) {
+	tokens, err := lexQuery(s)
+	if err != nil {
+		return nil, err
+	}
+
+	q := &Query{}
+	or, not := false, false
+	for _, t := range tokens {
+		if t.field != "" {
+			if t.exclude {
+				return nil, queryError("-%s: filters cannot be excluded", t.field)
+			}
+			if err := q.setField(t.field, t.text); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if !t.quoted && !t.exclude {
+			switch t.text {
+			case "OR":
+				if len(q.Groups) == 0 || or {
+					return nil, queryError("OR needs a word or phrase on each side")
+				}
+				or = true
+				continue
+			case "AND":
+				continue // terms must all match anyway
+			case "NOT":
+				not = true
+				continue
+			}
+		}
+
+		term := Term{Text: t.text, Phrase: t.quoted}
+		if !t.quoted {
+			term.Text = strings.Trim(term.Text, "()")
+			if len(term.Text) > 1 && strings.HasSuffix(term.Text, "*") {
+				term.Text, term.Prefix = strings.TrimSuffix(term.Text, "*"), true
+			}
+		}
+		if !strings.ContainsFunc(term.Text, isWordRune) {
+			continue // punctuation alone matches nothing
+		}
+
+		switch {
+		case t.exclude || not:
+			if or {
+				return nil, queryError("OR needs a word or phrase on each side")
+			}
+			q.Exclude = append(q.Exclude, term)
+		case or:
+			last := len(q.Groups) - 1
+			q.Groups[last] = append(q.Groups[last], term)
+		default:
+			q.Groups = append(q.Groups, []Term{term})
+		}
+		or, not = false, false
+	}
+
+	if or {
+		return nil, queryError("OR needs a word or phrase on each side")
+	}
+	if len(q.Groups) == 0 {
+		if len(q.Exclude) > 0 {
+			return nil, queryError("nothing to search for; -%s only excludes", q.Exclude[0].Text)
+		}
+		return nil, queryError("nothing to search for; add a word or phrase")
+	}
+	return q, nil
+}
+
+// lexQuery splits a query into tokens at whitespace outside quotes.
+func lexQuery(s string) ([]token, error) {
+	var tokens []token
+	for {
+		s = strings.TrimLeftFunc(s, unicode.IsSpace)
+		if s == "" {
+			return tokens, nil
+		}
+
+		var t token
+		if len(s) > 1 && s[0] == '-' && !unicode.IsSpace(rune(s[1])) {
+			t.exclude = true
+			s = s[1:]
+		}
+		if name, value, ok := strings.Cut(s, ":"); ok && slices.Contains(queryFields, strings.ToLower(name)) {
+			t.field = strings.ToLower(name)
+			s = value
+		}
+
+		if strings.HasPrefix(s, `"`) {
+			end := strings.IndexByte(s[1:], '"')
+			if end < 0 {
+				return nil, queryError("missing closing quote after %s", s)
+			}
+			t.text, t.quoted = s[1:end+1], true
+			s = s[end+2:]
+		} else {
+			end := strings.IndexFunc(s, unicode.IsSpace)
+			if end < 0 {
+				end = len(s)
+			}
+			t.text = s[:end]
+			s = s[end:]
+		}
+
+		if t.field != "" && t.text == "" {
+			return nil, queryError("%s: needs a value, e.g. %s", t.field, fieldExample(t.field))
+		}
+		tokens = append(tokens, t)
+	}
+}
+
+func fieldExample(field string) string {
+	switch field {
+	case "role":
+		return "role:user"
+	case "kind":
+		return "kind:tool_call"
+	case "source":
+		return "source:claude"
+	case "after", "before":
+		return field + ":2026-03-01 or " + field + ":3d"
+	}
+	return "repo:api"
+}
+
+func (q *Query) setField(field, value string) error {
+	switch field {
+	case "repo":
+		q.Repo = value
+	case "role":
+		if !slices.Contains(roles, value) {
+			return queryError("unknown role %q (want %s)", value, strings.Join(roles, ", "))
+		}
+		q.Role = value
+	case "kind":
+		if !slices.Contains(kinds, value) {
+			return queryError("unknown kind %q (want %s)", value, strings.Join(kinds, ", "))
+		}
+		q.Kind = value
+	case "source":
+		if source.Get(value) == nil {
+			return queryError("unknown source %q (want %s)", value, strings.Join(source.Names(), ", "))
+		}
+		q.Source = value
+	case "after", "before":
+		// both from the start of a day: before: excludes the day itself
+		from, _, err := parseTime(value, time.Now())
+		if err != nil {
+			return queryError("%s: %v", field, err)
+		}
+		if field == "after" {
+			q.After = from.UTC().Format(timestampLayout)
+		} else {
+			q.Before = from.UTC().Format(timestampLayout)
+		}
+	}
+	return nil
+}
+
+// apply returns opts with the query's filters in place of theirs.
+func (q *Query) apply(opts Options) Options {
+	if q.Repo != "" {
+		opts.Repo = q.Repo
+	}
+	if q.Role != "" {
+		opts.Role = q.Role
+	}
+	if q.Kind != "" {
+		opts.Kind = q.Kind
+	}
+	if q.Source != "" {
+		opts.Source = q.Source
+	}
+	if q.After != "" {
+		opts.Since = q.After
+	}
+	if q.Before != "" {
+		opts.Until = q.Before
+	}
+	return opts
+}
+
+// Words returns the terms to be found, e.g. for highlighting.
+func (q *Query) Words() []string {
+	var words []string
+	for _, g := range q.Groups {
+		for _, t := range g {
+			words = append(words, t.Text)
+		}
+	}
+	return words
+}
+
+// match compiles the terms to an FTS5 MATCH expression. Every term is
+// quoted, so punctuation in it cannot be taken for FTS5 syntax.
+func (q *Query) match() string {
+	return q.compile(true)
+}
+
+// trigramMatch is match for the trigram index, where every term matches as
+// a substring anyway. ok is false if a term is shorter than the three
+// characters a trigram needs.
+func (q *Query) trigramMatch() (string, bool) {
+	for _, t := range slices.Concat(slices.Concat(q.Groups...), q.Exclude) {
+		if utf8.RuneCountInString(t.Text) < 3 {
+			return "", false
+		}
+	}
+	return q.compile(false), true
+}
+
+func (q *Query) compile(prefixes bool) string {
+	groups := make([]string, len(q.Groups))
+	for i, g := range q.Groups {
+		alts := make([]string, len(g))
+		for j, t := range g {
+			alts[j] = t.fts(prefixes)
+		}
+		groups[i] = strings.Join(alts, " OR ")
+		if len(alts) > 1 {
+			groups[i] = "(" + groups[i] + ")"
+		}
+	}
+	m := strings.Join(groups, " AND ")
+	if len(q.Exclude) > 0 {
+		m = "(" + m + ")"
+		for _, t := range q.Exclude {
+			m += " NOT " + t.fts(prefixes)
+		}
+	}
+	return m
+}
+
+func (t Term) fts(prefix bool) string {
+	s := `"` + strings.ReplaceAll(t.Text, `"`, `""`) + `"`
+	if prefix && t.Prefix {
+		s += "*"
+	}
+	return s
+}
+
+// likeConditions compiles the terms to LIKE conditions on c.text, for
+// substrings too short for the trigram index.
+func (q *Query) likeConditions() ([]string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+	for _, g := range q.Groups {
+		alts := make([]string, len(g))
+		for i, t := range g {
+			alts[i] = "c.text LIKE ?"
+			args = append(args, "%"+t.Text+"%")
+		}
+		conditions = append(conditions, "("+strings.Join(alts, " OR ")+")")
+	}
+	for _, t := range q.Exclude {
+		conditions = append(conditions, "c.text NOT LIKE ?")
+		args = append(args, "%"+t.Text+"%")
+	}
+	return conditions, args
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
@@ -0,0 +1,161 @@
+package search
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	// source: filters are checked against the registered sources
+	_ "github.com/Zuo-Peng/ai-session-search/internal/source/codex"
+)
+
+func TestParseQuery(t *testing.T) {
+	word := func(s string) Term { return Term{Text: s} }
+	phrase := func(s string) Term { return Term{Text: s, Phrase: true} }
+
+	tests := []struct {
+		query string
+		want  Query
+	}{
+		{"retry", Query{Groups: [][]Term{{word("retry")}}}},
+		{"retry backoff", Query{Groups: [][]Term{{word("retry")}, {word("backoff")}}}},
+		{"retry OR backoff", Query{Groups: [][]Term{{word("retry"), word("backoff")}}}},
+		{"a OR b OR c d", Query{Groups: [][]Term{{word("a"), word("b"), word("c")}, {word("d")}}}},
+		{"retry AND backoff", Query{Groups: [][]Term{{word("retry")}, {word("backoff")}}}},
+		{"retry -flaky", Query{Groups: [][]Term{{word("retry")}}, Exclude: []Term{word("flaky")}}},
+		{"retry NOT flaky", Query{Groups: [][]Term{{word("retry")}}, Exclude: []Term{word("flaky")}}},
+		{"pars*", Query{Groups: [][]Term{{{Text: "pars", Prefix: true}}}}},
+		{"(retry)", Query{Groups: [][]Term{{word("retry")}}}},
+		{"retry - x", Query{Groups: [][]Term{{word("retry")}, {word("x")}}}},
+
+		// quoting
+		{`"exact phrase"`, Query{Groups: [][]Term{{phrase("exact phrase")}}}},
+		{`"exact phrase" word`, Query{Groups: [][]Term{{phrase("exact phrase")}, {word("word")}}}},
+		{`x -"not this"`, Query{Groups: [][]Term{{word("x")}}, Exclude: []Term{phrase("not this")}}},
+		{`"OR"`, Query{Groups: [][]Term{{phrase("OR")}}}},
+		{`"pars*"`, Query{Groups: [][]Term{{phrase("pars*")}}}},
+		{`"a:b"`, Query{Groups: [][]Term{{phrase("a:b")}}}},
+
+		// fields
+		{"repo:api role:user kind:tool_call source:codex x", Query{
+			Groups: [][]Term{{word("x")}},
+			Repo:   "api", Role: "user", Kind: "tool_call", Source: "codex",
+		}},
+		{"REPO:api x", Query{Groups: [][]Term{{word("x")}}, Repo: "api"}},
+		{`repo:"my api" x`, Query{Groups: [][]Term{{word("x")}}, Repo: "my api"}},
+		{"repo:a repo:b x", Query{Groups: [][]Term{{word("x")}}, Repo: "b"}},
+
+		// words with colons that are not fields are searched for
+		{"foo:bar", Query{Groups: [][]Term{{word("foo:bar")}}}},
+		{"http://example.com", Query{Groups: [][]Term{{word("http://example.com")}}}},
+		{"internal/index/db.go", Query{Groups: [][]Term{{word("internal/index/db.go")}}}},
+
+		// punctuation alone is dropped
+		{"x -- ...", Query{Groups: [][]Term{{word("x")}}}},
+	}
+	for _, tt := range tests {
+		got, err := ParseQuery(tt.query)
+		if err != nil {
+			t.Errorf("ParseQuery(%q): %v", tt.query, err)
+			continue
+		}
+		if !reflect.DeepEqual(*got, tt.want) {
+			t.Errorf("ParseQuery(%q) = %+v, want %+v", tt.query, *got, tt.want)
+		}
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string // part of the error
+	}{
+		{"", "nothing to search for"},
+		{"   ", "nothing to search for"},
+		{"repo:api", "nothing to search for"},
+		{"-flaky", "-flaky only excludes"},
+		{`-"not this"`, "-not this only excludes"},
+
+		// quoting
+		{`"unclosed`, "missing closing quote"},
+		{`x "unclosed phrase`, "missing closing quote"},
+		{`repo:"unclosed`, "missing closing quote"},
+
+		// empty values
+		{"repo: x", "repo: needs a value, e.g. repo:api"},
+		{"role: x", "role: needs a value, e.g. role:user"},
+		{`kind:"" x`, "kind: needs a value"},
+		{"after: x", "after: needs a value, e.g. after:2026-03-01 or after:3d"},
+
+		// unknown values
+		{"role:usr x", `unknown role "usr" (want user, assistant, tool)`},
+		{"kind:tool x", `unknown kind "tool"`},
+		{"source:cursor x", `unknown source "cursor"`},
+		{"after:junk x", `after: "junk" is not a date`},
+		{"before:3x x", `before: "3x" is not a date`},
+
+		{"-repo:api x", "-repo: filters cannot be excluded"},
+		{"OR x", "OR needs a word or phrase on each side"},
+		{"x OR", "OR needs a word or phrase on each side"},
+		{"x OR OR y", "OR needs a word or phrase on each side"},
+		{"x OR -y", "OR needs a word or phrase on each side"},
+	}
+	for _, tt := range tests {
+		_, err := ParseQuery(tt.query)
+		if err == nil {
+			t.Errorf("ParseQuery(%q) succeeded, want error containing %q", tt.query, tt.want)
+			continue
+		}
+		if !strings.HasPrefix(err.Error(), "invalid query: ") || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("ParseQuery(%q) error = %q, want one containing %q", tt.query, err, tt.want)
+		}
+	}
+}
+
+func TestQueryMatch(t *testing.T) {
+	tests := []struct {
+		query string
+		match string
+	}{
+		{"retry", `"retry"`},
+		{"retry backoff", `"retry" AND "backoff"`},
+		{"retry OR backoff x", `("retry" OR "backoff") AND "x"`},
+		{"pars* -flaky", `("pars"*) NOT "flaky"`},
+		{`"exact phrase" -"not this"`, `("exact phrase") NOT "not this"`},
+		{"internal/index/db.go", `"internal/index/db.go"`},
+	}
+	for _, tt := range tests {
+		q, err := ParseQuery(tt.query)
+		if err != nil {
+			t.Errorf("ParseQuery(%q): %v", tt.query, err)
+			continue
+		}
+		if got := q.match(); got != tt.match {
+			t.Errorf("ParseQuery(%q).match() = %s, want %s", tt.query, got, tt.match)
+		}
+	}
+}
+
+func TestQueryTrigramMatch(t *testing.T) {
+	tests := []struct {
+		query string
+		match string
+		ok    bool
+	}{
+		{"pars*", `"pars"`, true},
+		{"全文搜索 OR 索引库", `("全文搜索" OR "索引库")`, true},
+		{"全文 索引", "", false},
+		{"abc -de", "", false},
+	}
+	for _, tt := range tests {
+		q, err := ParseQuery(tt.query)
+		if err != nil {
+			t.Errorf("ParseQuery(%q): %v", tt.query, err)
+			continue
+		}
+		got, ok := q.trigramMatch()
+		if got != tt.match || ok != tt.ok {
+			t.Errorf("ParseQuery(%q).trigramMatch() = %s, %v, want %s, %v", tt.query, got, ok, tt.match, tt.ok)
+		}
+	}
+}
@@ -1,32 +1,53 @@
 package search
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"strings"
+	"time"
 	"unicode"
 
 	"github.com/Zuo-Peng/ai-session-search/internal/index"
+	"github.com/Zuo-Peng/ai-session-search/internal/parse"
 )
 
 type Result struct {
-	SessionKey string
-	ChunkID    int
-	UpdatedAt  string
-	Source     string
-	RepoCwd    string
-	Summary    string
-	Snippet    string
-	Role       string
-	Rank       float64
+	SessionKey       string
+	ChunkID          int
+	UpdatedAt        string
+	Source           string
+	RepoCwd          string
+	Summary          string
+	Snippet          string
+	Role             string
+	Rank             float64
+	ParentSessionKey string // non-empty for subagent sessions
+	Archived         bool   // log file deleted; kept by the archive option
+	Host             string // machine the session ran on
 }
 
 type Options struct {
-	Query  string
+	Query  string // in the query language, see Query
 	Source string // "" = all, "claude", "codex"
-	Role   string // "" = all, "user", "assistant"
-	Since  string // "" = no filter, e.g. "2024-01-01"
+	Role   string // "" = all, "user", "assistant", "tool"
+	Kind   string // "" = all, "text", "thinking", "tool_call", "tool_result"
+	Since  string // "" = no filter; a date or age, e.g. "2024-01-01", "3d", "last monday"
+	Until  string // "" = no filter; like Since, through the end of a day
+	Repo   string // "" = all; substring of the session's working directory
+	Model  string // "" = all; substring of any model used in the session
+	Branch string // "" = all; exact git branch the session ran on
+	Remote string // "" = all; git remote URL, any form, matched after normalizing
+	Host   string // "" = all; machine the session ran on
 	Limit  int
+
+	// Substring matches each term anywhere inside words via the trigram
+	// index, as CJK queries always do.
+	Substring bool
+
+	// IncludeSubagents also returns subagent transcripts; ListAll nests
+	// them directly after their parent session.
+	IncludeSubagents bool
 }
 
 // containsCJK returns true if the string contains any CJK Unified Ideograph.
@@ -78,9 +99,61 @@ func makeSnippet(text, query string, contextChars int) string {
 	return prefix + snippet + suffix
 }
 
+// appendSessionFilters adds the filters on session columns. Model and
+// branch match the ", "-joined lists stored on the session row.
+func appendSessionFilters(conditions []string, args []interface{}, opts Options) ([]string, []interface{}) {
+	if opts.Source != "" {
+		conditions = append(conditions, "s.source = ?")
+		args = append(args, opts.Source)
+	}
+	if opts.Repo != "" {
+		conditions = append(conditions, "s.repo_cwd LIKE ?")
+		args = append(args, "%"+opts.Repo+"%")
+	}
+	if opts.Model != "" {
+		conditions = append(conditions, "s.model LIKE ?")
+		args = append(args, "%"+opts.Model+"%")
+	}
+	if opts.Branch != "" {
+		conditions = append(conditions, "(', ' || s.git_branch || ', ') LIKE ?")
+		args = append(args, "%, "+opts.Branch+", %")
+	}
+	if opts.Remote != "" {
+		// substring, so "owner/repo" matches without the host
+		conditions = append(conditions, "s.repo_url LIKE ?")
+		args = append(args, "%"+parse.NormalizeRepoURL(opts.Remote)+"%")
+	}
+	if opts.Host != "" {
+		conditions = append(conditions, "s.host = ?")
+		args = append(args, opts.Host)
+	}
+	return conditions, args
+}
+
+// appendDateFilters adds the Since and Until bounds, as resolved by
+// resolveDates, on the time column: the session's last update for session
+// listings, hitTime for hits.
+func appendDateFilters(conditions []string, args []interface{}, opts Options, column string) ([]string, []interface{}) {
+	if opts.Since != "" {
+		conditions = append(conditions, column+" >= ?")
+		args = append(args, opts.Since)
+	}
+	if opts.Until != "" {
+		conditions = append(conditions, column+" < ?")
+		args = append(args, opts.Until)
+	}
+	return conditions, args
+}
+
 // ListAll returns all sessions ordered by updated_at DESC (no FTS).
 // When opts.Query is non-empty, it filters by summary/repo_cwd LIKE match.
-func ListAll(db *index.DB, opts Options) ([]Result, error) {
+// The query is abandoned when ctx is cancelled.
+func ListAll(ctx context.Context, db *index.DB, opts Options) ([]Result, error) {
+	opts, err := resolveDates(opts, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
 	var conditions []string
 	var args []interface{}
 
@@ -89,13 +162,10 @@ func ListAll(db *index.DB, opts Options) ([]Result, error) {
 		q := "%" + opts.Query + "%"
 		args = append(args, q, q)
 	}
-	if opts.Source != "" {
-		conditions = append(conditions, "s.source = ?")
-		args = append(args, opts.Source)
-	}
-	if opts.Since != "" {
-		conditions = append(conditions, "s.updated_at >= ?")
-		args = append(args, opts.Since)
+	conditions, args = appendSessionFilters(conditions, args, opts)
+	conditions, args = appendDateFilters(conditions, args, opts, "s.updated_at")
+	if !opts.IncludeSubagents {
+		conditions = append(conditions, "s.parent_session_key = ''")
 	}
 
 	where := ""
@@ -114,16 +184,19 @@ func ListAll(db *index.DB, opts Options) ([]Result, error) {
 			s.updated_at,
 			s.source,
 			s.repo_cwd,
-			s.summary
+			s.summary,
+			s.parent_session_key,
+			s.archived,
+			s.host
 		FROM sessions s
 		%s
 		ORDER BY s.updated_at DESC
 		%s
 	`, where, limitClause)
 
-	rows, err := db.Raw().Query(query, args...)
+	rows, err := db.Raw().QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("list query: %w", err)
+		return nil, queryErr(ctx, fmt.Errorf("list query: %w", err))
 	}
 	defer rows.Close()
 
@@ -133,6 +206,7 @@ func ListAll(db *index.DB, opts Options) ([]Result, error) {
 		if err := rows.Scan(
 			&r.SessionKey, &r.UpdatedAt,
 			&r.Source, &r.RepoCwd, &r.Summary,
+			&r.ParentSessionKey, &r.Archived, &r.Host,
 		); err != nil {
 			return nil, err
 		}
@@ -140,10 +214,51 @@ func ListAll(db *index.DB, opts Options) ([]Result, error) {
 		r.Snippet = r.Summary
 		results = append(results, r)
 	}
-	return results, rows.Err()
+	if err := rows.Err(); err != nil {
+		return nil, queryErr(ctx, err)
+	}
+	if opts.IncludeSubagents {
+		results = nestSubagents(results)
+	}
+	return results, nil
 }
 
-func Search(db *index.DB, opts Options) ([]Result, error) {
+// nestSubagents reorders results so each subagent session directly follows
+// its parent. Subagents whose parent is not in results keep their position.
+func nestSubagents(results []Result) []Result {
+	present := make(map[string]bool, len(results))
+	for _, r := range results {
+		present[r.SessionKey] = true
+	}
+	children := make(map[string][]Result)
+	for _, r := range results {
+		if r.ParentSessionKey != "" && present[r.ParentSessionKey] {
+			children[r.ParentSessionKey] = append(children[r.ParentSessionKey], r)
+		}
+	}
+
+	nested := make([]Result, 0, len(results))
+	for _, r := range results {
+		if r.ParentSessionKey != "" && present[r.ParentSessionKey] {
+			continue
+		}
+		nested = append(nested, r)
+		nested = append(nested, children[r.SessionKey]...)
+	}
+	return nested
+}
+
+// Search runs a full-text query and returns the best hit of each session.
+// The query is abandoned when ctx is cancelled. An opts.Query that does not
+// parse is reported with an error meant for the user.
+func Search(ctx context.Context, db *index.DB, opts Options) ([]Result, error) {
+	q, err := ParseQuery(opts.Query)
+	if err != nil {
+		return nil, err
+	}
+	if opts, err = resolveDates(q.apply(opts), time.Now()); err != nil {
+		return nil, err
+	}
 	if opts.Limit <= 0 {
 		opts.Limit = 100
 	}
@@ -153,14 +268,18 @@ func Search(db *index.DB, opts Options) ([]Result, error) {
 	opts.Limit = origLimit * 3
 
 	var results []Result
-	var err error
-	if containsCJK(opts.Query) {
-		results, err = searchLike(db, opts)
+	if containsCJK(opts.Query) || opts.Substring {
+		if match, ok := q.trigramMatch(); ok {
+			results, err = searchFTS(ctx, db, opts, "chunks_trigram", match)
+		} else {
+			// trigrams need three characters per term; scan for shorter ones
+			results, err = searchLike(ctx, db, opts, q)
+		}
 	} else {
-		results, err = searchFTS(db, opts)
+		results, err = searchFTS(ctx, db, opts, "chunks_fts", q.match())
 	}
 	if err != nil {
-		return nil, err
+		return nil, queryErr(ctx, err)
 	}
 
 	// Deduplicate: keep only the best-ranked result per session
@@ -179,19 +298,24 @@ func Search(db *index.DB, opts Options) ([]Result, error) {
 	return deduped, nil
 }
 
-func searchFTS(db *index.DB, opts Options) ([]Result, error) {
+// queryErr reports a query interrupted by cancelling ctx with ctx's error,
+// so callers can tell it from a failure.
+func queryErr(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// searchFTS runs match against ftsTable, chunks_fts (words) or
+// chunks_trigram (substrings).
+func searchFTS(ctx context.Context, db *index.DB, opts Options, ftsTable, match string) ([]Result, error) {
 	var conditions []string
 	var args []interface{}
 
 	// FTS match
-	conditions = append(conditions, "chunks_fts MATCH ?")
-	args = append(args, opts.Query)
-
-	// source filter
-	if opts.Source != "" {
-		conditions = append(conditions, "s.source = ?")
-		args = append(args, opts.Source)
-	}
+	conditions = append(conditions, ftsTable+" MATCH ?")
+	args = append(args, match)
 
 	// role filter
 	if opts.Role != "" {
@@ -199,10 +323,20 @@ func searchFTS(db *index.DB, opts Options) ([]Result, error) {
 		args = append(args, opts.Role)
 	}
 
-	// since filter
-	if opts.Since != "" {
-		conditions = append(conditions, "s.updated_at >= ?")
-		args = append(args, opts.Since)
+	// kind filter
+	if opts.Kind != "" {
+		conditions = append(conditions, "c.kind = ?")
+		args = append(args, opts.Kind)
+	}
+
+	// source/repo/model/branch/remote/host filters
+	conditions, args = appendSessionFilters(conditions, args, opts)
+
+	// dates of the hit itself, not just of its session
+	conditions, args = appendDateFilters(conditions, args, opts, hitTime)
+
+	if !opts.IncludeSubagents {
+		conditions = append(conditions, "s.parent_session_key = ''")
 	}
 
 	where := strings.Join(conditions, " AND ")
@@ -215,20 +349,23 @@ func searchFTS(db *index.DB, opts Options) ([]Result, error) {
 			s.source,
 			s.repo_cwd,
 			s.summary,
-			snippet(chunks_fts, 0, '>>>','<<<', '...', 40) as snip,
+			snippet(%[1]s, 0, '>>>','<<<', '...', 40) as snip,
 			c.role,
-			bm25(chunks_fts, 1.0) as rank
-		FROM chunks_fts
-		JOIN chunks c ON chunks_fts.rowid = c.rowid
+			bm25(%[1]s, 1.0) as rank,
+			s.parent_session_key,
+			s.archived,
+			s.host
+		FROM %[1]s
+		JOIN chunks c ON %[1]s.rowid = c.rowid
 		JOIN sessions s ON c.session_key = s.session_key
-		WHERE %s
+		WHERE %[2]s
 		ORDER BY rank
 		LIMIT ?
-	`, where)
+	`, ftsTable, where)
 
 	args = append(args, opts.Limit)
 
-	rows, err := db.Raw().Query(query, args...)
+	rows, err := db.Raw().QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("search query: %w", err)
 	}
@@ -237,19 +374,9 @@ func searchFTS(db *index.DB, opts Options) ([]Result, error) {
 	return scanResults(rows)
 }
 
-func searchLike(db *index.DB, opts Options) ([]Result, error) {
-	var conditions []string
-	var args []interface{}
-
-	// LIKE match for CJK substring search
-	conditions = append(conditions, "c.text LIKE ?")
-	args = append(args, "%"+opts.Query+"%")
-
-	// source filter
-	if opts.Source != "" {
-		conditions = append(conditions, "s.source = ?")
-		args = append(args, opts.Source)
-	}
+func searchLike(ctx context.Context, db *index.DB, opts Options, q *Query) ([]Result, error) {
+	// LIKE match for substrings too short for the trigram index
+	conditions, args := q.likeConditions()
 
 	// role filter
 	if opts.Role != "" {
@@ -257,10 +384,20 @@ func searchLike(db *index.DB, opts Options) ([]Result, error) {
 		args = append(args, opts.Role)
 	}
 
-	// since filter
-	if opts.Since != "" {
-		conditions = append(conditions, "s.updated_at >= ?")
-		args = append(args, opts.Since)
+	// kind filter
+	if opts.Kind != "" {
+		conditions = append(conditions, "c.kind = ?")
+		args = append(args, opts.Kind)
+	}
+
+	// source/repo/model/branch/remote/host filters
+	conditions, args = appendSessionFilters(conditions, args, opts)
+
+	// dates of the hit itself, not just of its session
+	conditions, args = appendDateFilters(conditions, args, opts, hitTime)
+
+	if !opts.IncludeSubagents {
+		conditions = append(conditions, "s.parent_session_key = ''")
 	}
 
 	where := strings.Join(conditions, " AND ")
@@ -274,7 +411,10 @@ func searchLike(db *index.DB, opts Options) ([]Result, error) {
 			s.repo_cwd,
 			s.summary,
 			c.text,
-			c.role
+			c.role,
+			s.parent_session_key,
+			s.archived,
+			s.host
 		FROM chunks c
 		JOIN sessions s ON c.session_key = s.session_key
 		WHERE %s
@@ -284,7 +424,7 @@ func searchLike(db *index.DB, opts Options) ([]Result, error) {
 
 	args = append(args, opts.Limit)
 
-	rows, err := db.Raw().Query(query, args...)
+	rows, err := db.Raw().QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("search query: %w", err)
 	}
@@ -298,10 +438,11 @@ func searchLike(db *index.DB, opts Options) ([]Result, error) {
 			&r.SessionKey, &r.ChunkID, &r.UpdatedAt,
 			&r.Source, &r.RepoCwd, &r.Summary,
 			&fullText, &r.Role,
+			&r.ParentSessionKey, &r.Archived, &r.Host,
 		); err != nil {
 			return nil, err
 		}
-		r.Snippet = makeSnippet(fullText, opts.Query, 30)
+		r.Snippet = makeSnippet(fullText, q.Groups[0][0].Text, 30)
 		r.Rank = 0
 		results = append(results, r)
 	}
@@ -316,6 +457,7 @@ func scanResults(rows *sql.Rows) ([]Result, error) {
 			&r.SessionKey, &r.ChunkID, &r.UpdatedAt,
 			&r.Source, &r.RepoCwd, &r.Summary,
 			&r.Snippet, &r.Role, &r.Rank,
+			&r.ParentSessionKey, &r.Archived, &r.Host,
 		); err != nil {
 			return nil, err
 		}
@@ -0,0 +1,73 @@
+package aider
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Zuo-Peng/ai-session-search/internal/config"
+	"github.com/Zuo-Peng/ai-session-search/internal/parse"
+	"github.com/Zuo-Peng/ai-session-search/internal/source"
+)
+
+const (
+	chatHistoryFile  = ".aider.chat.history.md"
+	inputHistoryFile = ".aider.input.history"
+)
+
+func init() {
+	source.Register(Source{})
+}
+
+// Source reads the chat history files aider writes into each repository.
+type Source struct{}
+
+func (Source) Name() string { return "aider" }
+
+// ScatteredLogs marks aider roots as trees of repositories; see
+// source.Scattered.
+func (Source) ScatteredLogs() {}
+
+func (Source) Roots(cfg *config.Config) []string {
+	return cfg.AiderRoots
+}
+
+// skipDirs are never descended into when searching for aider histories.
+var skipDirs = map[string]bool{
+	"node_modules": true,
+	"vendor":       true,
+	"__pycache__":  true,
+	"venv":         true,
+	"target":       true,
+	"dist":         true,
+	"build":        true,
+}
+
+// Match accepts .aider.chat.history.md, and .aider.input.history only when
+// the repo has no chat history (which already contains every input).
+func (Source) Match(path string, info os.FileInfo) bool {
+	base := filepath.Base(path)
+	if info.IsDir() {
+		return !strings.HasPrefix(base, ".") && !skipDirs[base]
+	}
+	switch base {
+	case chatHistoryFile:
+		return true
+	case inputHistoryFile:
+		_, err := os.Stat(filepath.Join(filepath.Dir(path), chatHistoryFile))
+		return os.IsNotExist(err)
+	}
+	return false
+}
+
+func (Source) Parse(path, root string) (*parse.ParseResult, error) {
+	return Parse(path, root)
+}
+
+// ResumeCommand restarts aider with the previous chat loaded; the caller
+// prepends the cd into the repo.
+func (Source) ResumeCommand(filePath string) string {
+	return "aider --restore-chat-history"
+}
+
+func (Source) Color() string { return "14" } // bright cyan
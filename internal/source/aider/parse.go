@@ -0,0 +1,197 @@
+package aider
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Zuo-Peng/ai-session-search/internal/parse"
+)
+
+const (
+	chatStartedPrefix = "# aider chat started at "
+	chatTimeLayout    = "2006-01-02 15:04:05"
+	inputTimeLayout   = "2006-01-02 15:04:05.999999"
+)
+
+// Parse reads an aider chat or input history. aiderRoot is the search root
+// the file was found under and determines the session key.
+func Parse(filePath, aiderRoot string) (*parse.ParseResult, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	rel, err := filepath.Rel(aiderRoot, filePath)
+	if err != nil {
+		rel = filePath
+	}
+	sessionKey := "aider:" + rel
+
+	result := &parse.ParseResult{
+		Meta: parse.SessionMeta{
+			SessionKey: sessionKey,
+			Source:     "aider",
+			FilePath:   filePath,
+			RepoCwd:    findRepoRoot(filepath.Dir(filePath), aiderRoot),
+			Mtime:      info.ModTime(),
+			Size:       info.Size(),
+		},
+	}
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), parse.MaxLineSize)
+
+	b := &blockParser{sessionKey: sessionKey}
+	if filepath.Base(filePath) == inputHistoryFile {
+		b.parseInputHistory(scanner)
+	} else {
+		b.parseChatHistory(scanner)
+	}
+
+	result.Chunks = b.chunks
+	result.Meta.CreatedAt = b.firstTS
+	result.Meta.UpdatedAt = b.lastTS
+	result.Meta.Summary = parse.Summarize(result.Chunks)
+
+	return result, scanner.Err()
+}
+
+// blockParser groups consecutive lines of the same role into chunks.
+type blockParser struct {
+	sessionKey      string
+	chunks          []parse.Chunk
+	firstTS, lastTS time.Time
+
+	ts        time.Time // timestamp of the current chat segment
+	role      string
+	lines     []string
+	startLine int
+}
+
+// parseChatHistory reads .aider.chat.history.md. Each run of aider appends a
+// "# aider chat started at" header; user input is prefixed with "####",
+// aider's own notices with ">", and everything else is the model's reply.
+func (b *blockParser) parseChatHistory(scanner *bufio.Scanner) {
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := scanner.Text()
+
+		if strings.HasPrefix(line, chatStartedPrefix) {
+			b.flush()
+			b.ts = parseLocalTime(chatTimeLayout, strings.TrimPrefix(line, chatStartedPrefix))
+			continue
+		}
+
+		var role string
+		switch {
+		case line == "####" || strings.HasPrefix(line, "#### "):
+			role, line = "user", strings.TrimPrefix(strings.TrimPrefix(line, "####"), " ")
+		case line == ">" || strings.HasPrefix(line, "> "):
+			role, line = "tool", strings.TrimPrefix(strings.TrimPrefix(line, ">"), " ")
+		case strings.TrimSpace(line) == "":
+			// blank lines stay with the current block
+			if b.role != "" {
+				b.lines = append(b.lines, "")
+			}
+			continue
+		default:
+			role = "assistant"
+		}
+
+		if role != b.role {
+			b.flush()
+			b.role = role
+			b.startLine = lineNum
+		}
+		b.lines = append(b.lines, line)
+	}
+	b.flush()
+}
+
+// parseInputHistory reads .aider.input.history, where each prompt is a
+// "# <timestamp>" line followed by "+"-prefixed input lines.
+func (b *blockParser) parseInputHistory(scanner *bufio.Scanner) {
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := scanner.Text()
+
+		switch {
+		case strings.HasPrefix(line, "# "):
+			b.flush()
+			b.ts = parseLocalTime(inputTimeLayout, strings.TrimPrefix(line, "# "))
+		case strings.HasPrefix(line, "+"):
+			if b.role == "" {
+				b.role = "user"
+				b.startLine = lineNum
+			}
+			b.lines = append(b.lines, strings.TrimPrefix(line, "+"))
+		}
+	}
+	b.flush()
+}
+
+func (b *blockParser) flush() {
+	role := b.role
+	text := strings.TrimSpace(strings.Join(b.lines, "\n"))
+	b.role = ""
+	b.lines = b.lines[:0]
+	if role == "" || text == "" {
+		return
+	}
+
+	c := parse.Chunk{
+		SessionKey: b.sessionKey,
+		ChunkID:    len(b.chunks),
+		Timestamp:  b.ts,
+		Role:       role,
+		Kind:       "text",
+		Text:       text,
+		LineNumber: b.startLine,
+	}
+	if role == "tool" {
+		c.Kind = "tool_result"
+		c.Tool = "aider"
+	}
+	b.chunks = append(b.chunks, c)
+
+	if b.firstTS.IsZero() {
+		b.firstTS = b.ts
+	}
+	if !b.ts.IsZero() {
+		b.lastTS = b.ts
+	}
+}
+
+// parseLocalTime parses aider's timestamps, which are in local time, and
+// returns them in UTC like the other sources.
+func parseLocalTime(layout, s string) time.Time {
+	t, err := time.ParseInLocation(layout, strings.TrimSpace(s), time.Local)
+	if err != nil {
+		return time.Time{}
+	}
+	return t.UTC()
+}
+
+// findRepoRoot returns the nearest directory at or above dir that contains
+// .git, without leaving the search root. It falls back to dir.
+func findRepoRoot(dir, root string) string {
+	for d := dir; ; d = filepath.Dir(d) {
+		if _, err := os.Stat(filepath.Join(d, ".git")); err == nil {
+			return d
+		}
+		if d == root || filepath.Dir(d) == d {
+			return dir
+		}
+	}
+}
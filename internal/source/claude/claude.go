@@ -0,0 +1,50 @@
+package claude
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Zuo-Peng/ai-session-search/internal/config"
+	"github.com/Zuo-Peng/ai-session-search/internal/parse"
+	"github.com/Zuo-Peng/ai-session-search/internal/source"
+)
+
+func init() {
+	source.Register(Source{})
+}
+
+// Source reads Claude Code transcripts from ~/.claude/projects.
+type Source struct{}
+
+func (Source) Name() string { return "claude" }
+
+func (Source) Roots(cfg *config.Config) []string {
+	return []string{cfg.ClaudeRoot}
+}
+
+func (Source) Match(path string, info os.FileInfo) bool {
+	if info.IsDir() {
+		return true
+	}
+	if filepath.Ext(path) != ".jsonl" {
+		return false
+	}
+	return !strings.Contains(filepath.Base(path), "sessions-index")
+}
+
+func (Source) Parse(path, root string) (*parse.ParseResult, error) {
+	return Parse(path, root)
+}
+
+func (Source) ParseFrom(path, root string, cur parse.Cursor) (*parse.ParseResult, error) {
+	return ParseFrom(path, root, cur)
+}
+
+func (Source) ResumeCommand(filePath string) string {
+	sessionID := strings.TrimSuffix(filepath.Base(filePath), ".jsonl")
+	return fmt.Sprintf("claude --resume %s", sessionID)
+}
+
+func (Source) Color() string { return "12" } // bright blue
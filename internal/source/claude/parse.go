@@ -0,0 +1,338 @@
+package claude
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Zuo-Peng/ai-session-search/internal/parse"
+)
+
+type claudeRecord struct {
+	Type        string          `json:"type"`
+	IsMeta      bool            `json:"isMeta"`
+	IsSidechain bool            `json:"isSidechain"`
+	SessionID   string          `json:"sessionId"`
+	Timestamp   string          `json:"timestamp"`
+	Cwd         string          `json:"cwd"`
+	Message     json.RawMessage `json:"message"`
+	Summary     string          `json:"summary"` // for type="summary" records
+	UUID        string          `json:"uuid"`
+	ParentUUID  string          `json:"parentUuid"`
+	GitBranch   string          `json:"gitBranch"`
+	Version     string          `json:"version"` // Claude Code version
+}
+
+type claudeMessage struct {
+	Role    string          `json:"role"`
+	Model   string          `json:"model"`
+	Content json.RawMessage `json:"content"`
+	Usage   *struct {
+		InputTokens  int `json:"input_tokens"`
+		OutputTokens int `json:"output_tokens"`
+	} `json:"usage"`
+}
+
+type claudeContentBlock struct {
+	Type      string          `json:"type"`
+	Text      string          `json:"text"`
+	ID        string          `json:"id"`          // tool_use
+	Name      string          `json:"name"`        // tool_use
+	Input     json.RawMessage `json:"input"`       // tool_use
+	ToolUseID string          `json:"tool_use_id"` // tool_result
+	Content   json.RawMessage `json:"content"`     // tool_result
+}
+
+// Parse reads a Claude Code session JSONL file. claudeRoot is the projects
+// directory the file was found under and determines the session key.
+func Parse(filePath, claudeRoot string) (*parse.ParseResult, error) {
+	return ParseFrom(filePath, claudeRoot, parse.Cursor{})
+}
+
+// ParseFrom parses the lines of a session file after cur. A partial last line
+// that does not decode yet is left for the next call.
+func ParseFrom(filePath, claudeRoot string, cur parse.Cursor) (*parse.ParseResult, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Seek(cur.Offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	// derive session key from path
+	rel, err := filepath.Rel(claudeRoot, filePath)
+	if err != nil {
+		rel = filePath
+	}
+	rel = strings.TrimSuffix(rel, ".jsonl")
+	sessionKey := "claude:" + rel
+
+	result := &parse.ParseResult{
+		Meta: parse.SessionMeta{
+			SessionKey:       sessionKey,
+			Source:           "claude",
+			FilePath:         filePath,
+			ParentSessionKey: claudeParentFromPath(rel),
+			Mtime:            info.ModTime(),
+			Size:             info.Size(),
+		},
+	}
+
+	offset := cur.Offset
+	scanner := parse.NewLineScanner(f, &offset)
+	result.Cursor = &parse.Cursor{Offset: cur.Offset, Line: cur.Line}
+
+	chunkID := 0
+	lineNum := cur.Line
+	var firstTS, lastTS time.Time
+	var summaryFromRecord string
+	var models, branches []string
+	toolNames := make(map[string]string) // tool_use id -> tool name, until answered
+	for id, name := range cur.Pending {
+		toolNames[id] = name
+	}
+
+	for scanner.Scan() {
+		lineNum++
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+
+		var rec claudeRecord
+		if err := json.Unmarshal(line, &rec); err != nil {
+			continue // corrupt, or a partial line still being written
+		}
+		result.Cursor.Offset = offset
+		result.Cursor.Line = lineNum
+
+		// capture summary record
+		if rec.Type == "summary" && rec.Summary != "" {
+			summaryFromRecord = rec.Summary
+			continue
+		}
+
+		// capture cwd from first record that has it
+		if rec.Cwd != "" && result.Meta.RepoCwd == "" {
+			result.Meta.RepoCwd = rec.Cwd
+		}
+		if rec.GitBranch != "" {
+			branches = appendUnique(branches, rec.GitBranch)
+		}
+		if rec.Version != "" {
+			result.Meta.Version = rec.Version
+		}
+
+		// legacy sidechain files (agent-*.jsonl next to the parent) name
+		// their parent via sessionId
+		if rec.IsSidechain && result.Meta.ParentSessionKey == "" && rec.SessionID != "" &&
+			rec.SessionID != filepath.Base(rel) {
+			result.Meta.ParentSessionKey = "claude:" + filepath.Join(filepath.Dir(rel), rec.SessionID)
+		}
+
+		if rec.IsMeta {
+			continue
+		}
+
+		if rec.Type != "user" && rec.Type != "assistant" {
+			continue
+		}
+
+		var msg claudeMessage
+		if err := json.Unmarshal(rec.Message, &msg); err != nil {
+			continue
+		}
+
+		role := rec.Type
+		content := extractClaudeContent(msg.Content)
+		if content.Text == "" && content.Thinking == "" && len(content.ToolCalls) == 0 && len(content.ToolResults) == 0 {
+			continue
+		}
+
+		ts := parse.Timestamp(rec.Timestamp)
+		if firstTS.IsZero() {
+			firstTS = ts
+		}
+		lastTS = ts
+
+		// "<synthetic>" marks messages Claude Code generated itself
+		if msg.Model != "" && msg.Model != "<synthetic>" {
+			models = appendUnique(models, msg.Model)
+		}
+
+		// fields shared by every chunk from this record
+		base := parse.Chunk{
+			SessionKey: sessionKey,
+			Timestamp:  ts,
+			LineNumber: lineNum,
+			UUID:       rec.UUID,
+			ParentUUID: rec.ParentUUID,
+			Model:      msg.Model,
+		}
+		if msg.Usage != nil {
+			base.InputTokens = msg.Usage.InputTokens
+			base.OutputTokens = msg.Usage.OutputTokens
+		}
+		emit := func(role, kind, tool, text string) {
+			c := base
+			c.ChunkID = chunkID
+			c.Role = role
+			c.Kind = kind
+			c.Tool = tool
+			c.Text = text
+			result.Chunks = append(result.Chunks, c)
+			chunkID++
+		}
+
+		// Emit thinking chunk before text chunk (if both exist)
+		if content.Thinking != "" {
+			emit(role, "thinking", "", content.Thinking)
+		}
+
+		if content.Text != "" {
+			emit(role, "text", "", content.Text)
+		}
+
+		for _, tc := range content.ToolCalls {
+			if tc.ID != "" {
+				toolNames[tc.ID] = tc.Name
+			}
+			emit("assistant", "tool_call", tc.Name, tc.Text)
+		}
+
+		for _, tr := range content.ToolResults {
+			emit("tool", "tool_result", toolNames[tr.ID], tr.Text)
+			delete(toolNames, tr.ID)
+		}
+	}
+
+	result.Meta.CreatedAt = firstTS
+	result.Meta.UpdatedAt = lastTS
+	result.Meta.Model = strings.Join(models, parse.ListSep)
+	result.Meta.GitBranch = strings.Join(branches, parse.ListSep)
+	result.Cursor.Pending = toolNames
+
+	// prefer summary from record, fallback to first user message
+	if summaryFromRecord != "" {
+		result.Meta.Summary = summaryFromRecord
+	} else if cur.Offset == 0 {
+		result.Meta.Summary = parse.Summarize(result.Chunks)
+	}
+
+	return result, scanner.Err()
+}
+
+// claudeParentFromPath returns the parent session key for a subagent
+// transcript stored as <project>/<sessionId>/subagents/<agent>.jsonl.
+func claudeParentFromPath(rel string) string {
+	dir := filepath.Dir(rel)
+	if filepath.Base(dir) != "subagents" {
+		return ""
+	}
+	return "claude:" + filepath.Dir(dir)
+}
+
+// appendUnique appends s to list unless it is already present.
+func appendUnique(list []string, s string) []string {
+	for _, v := range list {
+		if v == s {
+			return list
+		}
+	}
+	return append(list, s)
+}
+
+type extractedContent struct {
+	Text        string
+	Thinking    string
+	ToolCalls   []toolBlock
+	ToolResults []toolBlock
+}
+
+// toolBlock is a tool invocation or its output. ID links a result to its call.
+type toolBlock struct {
+	ID   string
+	Name string
+	Text string
+}
+
+func extractClaudeContent(raw json.RawMessage) extractedContent {
+	// try string first
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return extractedContent{Text: strings.TrimSpace(s)}
+	}
+
+	// try array of content blocks
+	var blocks []claudeContentBlock
+	if err := json.Unmarshal(raw, &blocks); err == nil {
+		var textParts []string
+		var thinkParts []string
+		var out extractedContent
+		for _, b := range blocks {
+			switch b.Type {
+			case "thinking":
+				if b.Text != "" {
+					thinkParts = append(thinkParts, b.Text)
+				}
+			case "text":
+				if b.Text != "" {
+					textParts = append(textParts, b.Text)
+				}
+			case "tool_use":
+				out.ToolCalls = append(out.ToolCalls, toolBlock{
+					ID:   b.ID,
+					Name: b.Name,
+					Text: parse.FormatToolInput(b.Input),
+				})
+			case "tool_result":
+				text := extractClaudeToolResult(b.Content)
+				if text == "" {
+					continue
+				}
+				out.ToolResults = append(out.ToolResults, toolBlock{
+					ID:   b.ToolUseID,
+					Text: text,
+				})
+			}
+		}
+		out.Text = strings.TrimSpace(strings.Join(textParts, "\n"))
+		out.Thinking = strings.TrimSpace(strings.Join(thinkParts, "\n"))
+		return out
+	}
+
+	return extractedContent{}
+}
+
+// extractClaudeToolResult flattens tool_result content, which is either a
+// plain string or an array of text blocks. Images and other blocks are dropped.
+func extractClaudeToolResult(raw json.RawMessage) string {
+	if len(raw) == 0 {
+		return ""
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return strings.TrimSpace(s)
+	}
+	var blocks []claudeContentBlock
+	if err := json.Unmarshal(raw, &blocks); err != nil {
+		return ""
+	}
+	var parts []string
+	for _, b := range blocks {
+		if b.Type == "text" && b.Text != "" {
+			parts = append(parts, b.Text)
+		}
+	}
+	return strings.TrimSpace(strings.Join(parts, "\n"))
+}
@@ -0,0 +1,58 @@
+package codex
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/Zuo-Peng/ai-session-search/internal/config"
+	"github.com/Zuo-Peng/ai-session-search/internal/parse"
+	"github.com/Zuo-Peng/ai-session-search/internal/source"
+)
+
+func init() {
+	source.Register(Source{})
+}
+
+// Source reads Codex rollout logs from ~/.codex/sessions.
+type Source struct{}
+
+func (Source) Name() string { return "codex" }
+
+func (Source) Roots(cfg *config.Config) []string {
+	return []string{cfg.CodexRoot}
+}
+
+func (Source) Match(path string, info os.FileInfo) bool {
+	return info.IsDir() || filepath.Ext(path) == ".jsonl"
+}
+
+func (Source) Parse(path, root string) (*parse.ParseResult, error) {
+	return Parse(path, root)
+}
+
+func (Source) ParseFrom(path, root string, cur parse.Cursor) (*parse.ParseResult, error) {
+	return ParseFrom(path, root, cur)
+}
+
+// ResumeCommand resumes by UUID, which Codex embeds in file names like
+// rollout-2026-01-26T17-30-22-019bf9a3-d433-7fc1-8214-b82613804964.
+func (Source) ResumeCommand(filePath string) string {
+	sessionID := strings.TrimSuffix(filepath.Base(filePath), ".jsonl")
+	return fmt.Sprintf("codex resume %s", extractUUID(sessionID))
+}
+
+func (Source) Color() string { return "10" } // bright green
+
+// uuidRe matches a standard UUID (8-4-4-4-12 hex pattern).
+var uuidRe = regexp.MustCompile(`[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}`)
+
+// extractUUID extracts a UUID from a string, returning the original if none found.
+func extractUUID(s string) string {
+	if m := uuidRe.FindString(s); m != "" {
+		return m
+	}
+	return s
+}
@@ -0,0 +1,347 @@
+package codex
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Zuo-Peng/ai-session-search/internal/parse"
+)
+
+// Top-level record in Codex JSONL
+type codexRecord struct {
+	Timestamp string          `json:"timestamp"`
+	Type      string          `json:"type"`
+	Payload   json.RawMessage `json:"payload"`
+}
+
+// session_meta payload
+type codexSessionMeta struct {
+	Cwd string `json:"cwd"`
+	Git *struct {
+		Branch        string `json:"branch"`
+		RepositoryURL string `json:"repository_url"`
+		CommitHash    string `json:"commit_hash"`
+	} `json:"git"`
+}
+
+// event_msg payload (flat, not nested)
+type codexEventPayload struct {
+	Type    string `json:"type"`
+	Message string `json:"message"` // for user_message
+	Text    string `json:"text"`    // for agent_reasoning
+}
+
+// response_item payload
+type codexResponsePayload struct {
+	Type    string `json:"type"`
+	Role    string `json:"role"`
+	Content []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"content"`
+
+	// function_call, custom_tool_call, local_shell_call and their outputs
+	Name      string          `json:"name"`
+	CallID    string          `json:"call_id"`
+	Arguments string          `json:"arguments"` // JSON-encoded, function_call
+	Input     string          `json:"input"`     // custom_tool_call
+	Output    json.RawMessage `json:"output"`    // *_output
+	Action    *struct {
+		Command          []string `json:"command"`
+		WorkingDirectory string   `json:"working_directory"`
+	} `json:"action"` // local_shell_call
+}
+
+// codexExecOutput is the JSON-encoded output of a shell function_call.
+type codexExecOutput struct {
+	Output   string `json:"output"`
+	Metadata *struct {
+		ExitCode *int `json:"exit_code"`
+	} `json:"metadata"`
+}
+
+// Parse reads a Codex rollout JSONL file. codexRoot is the sessions
+// directory the file was found under and determines the session key.
+func Parse(filePath, codexRoot string) (*parse.ParseResult, error) {
+	return ParseFrom(filePath, codexRoot, parse.Cursor{})
+}
+
+// ParseFrom parses the lines of a rollout file after cur. A partial last line
+// that does not decode yet is left for the next call.
+func ParseFrom(filePath, codexRoot string, cur parse.Cursor) (*parse.ParseResult, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Seek(cur.Offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	rel, err := filepath.Rel(codexRoot, filePath)
+	if err != nil {
+		rel = filePath
+	}
+	sessionKey := "codex:" + strings.TrimSuffix(rel, ".jsonl")
+
+	result := &parse.ParseResult{
+		Meta: parse.SessionMeta{
+			SessionKey: sessionKey,
+			Source:     "codex",
+			FilePath:   filePath,
+			Mtime:      info.ModTime(),
+			Size:       info.Size(),
+		},
+	}
+
+	offset := cur.Offset
+	scanner := parse.NewLineScanner(f, &offset)
+	result.Cursor = &parse.Cursor{Offset: cur.Offset, Line: cur.Line}
+
+	chunkID := 0
+	lineNum := cur.Line
+	var firstTS, lastTS time.Time
+	toolNames := make(map[string]string) // call_id -> tool name, until answered
+	for id, name := range cur.Pending {
+		toolNames[id] = name
+	}
+
+	for scanner.Scan() {
+		lineNum++
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+
+		var rec codexRecord
+		if err := json.Unmarshal(line, &rec); err != nil {
+			continue // corrupt, or a partial line still being written
+		}
+		result.Cursor.Offset = offset
+		result.Cursor.Line = lineNum
+
+		ts := parse.Timestamp(rec.Timestamp)
+
+		switch rec.Type {
+		case "session_meta":
+			var meta codexSessionMeta
+			if err := json.Unmarshal(rec.Payload, &meta); err == nil {
+				result.Meta.RepoCwd = meta.Cwd
+				if meta.Git != nil {
+					result.Meta.GitBranch = meta.Git.Branch
+					result.Meta.RepoURL = parse.NormalizeRepoURL(meta.Git.RepositoryURL)
+					result.Meta.GitCommit = meta.Git.CommitHash
+				}
+			}
+
+		case "event_msg":
+			var evt codexEventPayload
+			if err := json.Unmarshal(rec.Payload, &evt); err != nil {
+				continue
+			}
+
+			var role, kind, text string
+			switch evt.Type {
+			case "user_message":
+				role = "user"
+				kind = "text"
+				text = strings.TrimSpace(evt.Message)
+			case "agent_reasoning":
+				role = "assistant"
+				kind = "thinking"
+				text = strings.TrimSpace(evt.Text)
+			default:
+				continue
+			}
+
+			if text == "" {
+				continue
+			}
+			if firstTS.IsZero() {
+				firstTS = ts
+			}
+			lastTS = ts
+			result.Chunks = append(result.Chunks, parse.Chunk{
+				SessionKey: sessionKey,
+				ChunkID:    chunkID,
+				Timestamp:  ts,
+				Role:       role,
+				Kind:       kind,
+				Text:       text,
+				LineNumber: lineNum,
+			})
+			chunkID++
+
+		case "response_item":
+			var item codexResponsePayload
+			if err := json.Unmarshal(rec.Payload, &item); err != nil {
+				continue
+			}
+
+			if item.Type != "message" {
+				role, kind, tool, text := codexToolItem(&item, toolNames)
+				if kind == "" || text == "" {
+					continue
+				}
+				if firstTS.IsZero() {
+					firstTS = ts
+				}
+				lastTS = ts
+				result.Chunks = append(result.Chunks, parse.Chunk{
+					SessionKey: sessionKey,
+					ChunkID:    chunkID,
+					Timestamp:  ts,
+					Role:       role,
+					Kind:       kind,
+					Tool:       tool,
+					Text:       text,
+					LineNumber: lineNum,
+				})
+				chunkID++
+				continue
+			}
+
+			role := item.Role
+			if role == "" {
+				role = "assistant"
+			}
+
+			var parts []string
+			for _, c := range item.Content {
+				if (c.Type == "input_text" || c.Type == "output_text" || c.Type == "text") && c.Text != "" {
+					parts = append(parts, c.Text)
+				}
+			}
+			text := strings.TrimSpace(strings.Join(parts, "\n"))
+			if text == "" {
+				continue
+			}
+
+			if firstTS.IsZero() {
+				firstTS = ts
+			}
+			lastTS = ts
+			result.Chunks = append(result.Chunks, parse.Chunk{
+				SessionKey: sessionKey,
+				ChunkID:    chunkID,
+				Timestamp:  ts,
+				Role:       role,
+				Kind:       "text",
+				Text:       text,
+				LineNumber: lineNum,
+			})
+			chunkID++
+		}
+	}
+
+	result.Meta.CreatedAt = firstTS
+	result.Meta.UpdatedAt = lastTS
+	result.Cursor.Pending = toolNames
+
+	if cur.Offset == 0 {
+		result.Meta.Summary = parse.Summarize(result.Chunks)
+	}
+
+	return result, scanner.Err()
+}
+
+// codexToolItem converts a tool-related response_item into chunk fields.
+// Calls register their call_id so the matching output can be labelled with
+// the tool name. kind is empty for items that are not tool activity.
+func codexToolItem(item *codexResponsePayload, toolNames map[string]string) (role, kind, tool, text string) {
+	switch item.Type {
+	case "function_call":
+		toolNames[item.CallID] = item.Name
+		return "assistant", "tool_call", item.Name, formatCodexArguments(item.Arguments)
+
+	case "custom_tool_call":
+		toolNames[item.CallID] = item.Name
+		return "assistant", "tool_call", item.Name, strings.TrimSpace(item.Input)
+
+	case "local_shell_call":
+		if item.Action == nil {
+			return "", "", "", ""
+		}
+		toolNames[item.CallID] = "shell"
+		lines := []string{"command: " + joinCommand(item.Action.Command)}
+		if item.Action.WorkingDirectory != "" {
+			lines = append(lines, "workdir: "+item.Action.WorkingDirectory)
+		}
+		return "assistant", "tool_call", "shell", strings.Join(lines, "\n")
+
+	case "function_call_output", "custom_tool_call_output", "local_shell_call_output":
+		tool := toolNames[item.CallID]
+		delete(toolNames, item.CallID)
+		return "tool", "tool_result", tool, formatCodexOutput(item.Output)
+	}
+	return "", "", "", ""
+}
+
+// formatCodexArguments renders JSON-encoded function_call arguments, turning
+// shell argv arrays into a single command line.
+func formatCodexArguments(args string) string {
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(args), &fields); err != nil {
+		return strings.TrimSpace(args)
+	}
+	if argv, ok := fields["command"].([]interface{}); ok {
+		parts := make([]string, 0, len(argv))
+		for _, a := range argv {
+			if s, ok := a.(string); ok {
+				parts = append(parts, s)
+			}
+		}
+		fields["command"] = joinCommand(parts)
+	}
+	b, err := json.Marshal(fields)
+	if err != nil {
+		return strings.TrimSpace(args)
+	}
+	return parse.FormatToolInput(b)
+}
+
+// joinCommand turns an argv into a readable command line. The common
+// ["bash", "-lc", script] wrapper is reduced to the script itself.
+func joinCommand(argv []string) string {
+	if len(argv) == 3 && (argv[1] == "-lc" || argv[1] == "-c") {
+		return argv[2]
+	}
+	quoted := make([]string, len(argv))
+	for i, a := range argv {
+		if a == "" || strings.ContainsAny(a, " \t\n'\"") {
+			quoted[i] = "'" + strings.ReplaceAll(a, "'", `'\''`) + "'"
+		} else {
+			quoted[i] = a
+		}
+	}
+	return strings.Join(quoted, " ")
+}
+
+// formatCodexOutput extracts the text of a tool output. Shell outputs are a
+// JSON string wrapping {"output", "metadata": {"exit_code"}}; the exit code is
+// appended so failed commands can be found by searching for it.
+func formatCodexOutput(raw json.RawMessage) string {
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return strings.TrimSpace(string(raw))
+	}
+	var exec codexExecOutput
+	if err := json.Unmarshal([]byte(s), &exec); err != nil {
+		return strings.TrimSpace(s)
+	}
+	text := strings.TrimSpace(exec.Output)
+	if exec.Metadata != nil && exec.Metadata.ExitCode != nil {
+		text += fmt.Sprintf("\n[exit code %d]", *exec.Metadata.ExitCode)
+	}
+	return strings.TrimSpace(text)
+}
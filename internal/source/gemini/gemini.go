@@ -0,0 +1,71 @@
+package gemini
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Zuo-Peng/ai-session-search/internal/config"
+	"github.com/Zuo-Peng/ai-session-search/internal/parse"
+	"github.com/Zuo-Peng/ai-session-search/internal/source"
+)
+
+func init() {
+	source.Register(Source{})
+}
+
+// Source reads Gemini CLI chat logs and checkpoints from
+// ~/.gemini/tmp/<project-hash>/.
+type Source struct{}
+
+func (Source) Name() string { return "gemini" }
+
+func (Source) Roots(cfg *config.Config) []string {
+	return []string{cfg.GeminiRoot}
+}
+
+// Match accepts chats/session-*.json (automatic chat recording) and
+// checkpoint-*.json (saved with /chat save <tag>).
+func (Source) Match(path string, info os.FileInfo) bool {
+	if info.IsDir() {
+		return true
+	}
+	if filepath.Ext(path) != ".json" {
+		return false
+	}
+	return isChatFile(path) || strings.HasPrefix(filepath.Base(path), "checkpoint-")
+}
+
+func (Source) Parse(path, root string) (*parse.ParseResult, error) {
+	return Parse(path, root)
+}
+
+// ResumeCommand resumes recorded chats by session ID. Checkpoints can only be
+// resumed from inside Gemini CLI, so the tag is given as a trailing comment.
+func (Source) ResumeCommand(filePath string) string {
+	if !isChatFile(filePath) {
+		tag := strings.TrimPrefix(strings.TrimSuffix(filepath.Base(filePath), ".json"), "checkpoint-")
+		return fmt.Sprintf("gemini # then: /chat resume %s", tag)
+	}
+	data, err := os.ReadFile(filePath)
+	if err == nil {
+		var rec struct {
+			SessionID string `json:"sessionId"`
+		}
+		if json.Unmarshal(data, &rec) == nil && rec.SessionID != "" {
+			return fmt.Sprintf("gemini --resume %s", rec.SessionID)
+		}
+	}
+	return "gemini --resume"
+}
+
+func (Source) Color() string { return "13" } // bright magenta
+
+// isChatFile reports whether path is an automatically recorded chat
+// (chats/session-*.json) rather than a checkpoint.
+func isChatFile(path string) bool {
+	return filepath.Base(filepath.Dir(path)) == "chats" &&
+		strings.HasPrefix(filepath.Base(path), "session-")
+}
@@ -0,0 +1,267 @@
+package gemini
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Zuo-Peng/ai-session-search/internal/parse"
+)
+
+// chatRecord is a chats/session-*.json file.
+type chatRecord struct {
+	SessionID   string        `json:"sessionId"`
+	StartTime   string        `json:"startTime"`
+	LastUpdated string        `json:"lastUpdated"`
+	Summary     string        `json:"summary"`
+	Messages    []chatMessage `json:"messages"`
+}
+
+type chatMessage struct {
+	Timestamp string          `json:"timestamp"`
+	Type      string          `json:"type"` // "user", "gemini", "info", "error", "warning"
+	Content   json.RawMessage `json:"content"`
+	Thoughts  []struct {
+		Subject     string `json:"subject"`
+		Description string `json:"description"`
+	} `json:"thoughts"`
+	ToolCalls []struct {
+		Name          string          `json:"name"`
+		Args          json.RawMessage `json:"args"`
+		Result        []part          `json:"result"`
+		ResultDisplay json.RawMessage `json:"resultDisplay"`
+	} `json:"toolCalls"`
+}
+
+// part is a Gemini API content part, used by checkpoints and tool results.
+type part struct {
+	Text         string `json:"text"`
+	Thought      bool   `json:"thought"`
+	FunctionCall *struct {
+		Name string          `json:"name"`
+		Args json.RawMessage `json:"args"`
+	} `json:"functionCall"`
+	FunctionResponse *struct {
+		Name     string          `json:"name"`
+		Response json.RawMessage `json:"response"`
+	} `json:"functionResponse"`
+}
+
+// checkpointContent is one entry of a checkpoint-*.json history array.
+type checkpointContent struct {
+	Role  string `json:"role"` // "user" or "model"
+	Parts []part `json:"parts"`
+}
+
+// Parse reads a Gemini CLI chat recording or checkpoint. geminiRoot is the
+// tmp directory the file was found under and determines the session key.
+func Parse(filePath, geminiRoot string) (*parse.ParseResult, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	rel, err := filepath.Rel(geminiRoot, filePath)
+	if err != nil {
+		rel = filePath
+	}
+	sessionKey := "gemini:" + strings.TrimSuffix(rel, ".json")
+
+	projectDir := filepath.Dir(filePath)
+	if isChatFile(filePath) {
+		projectDir = filepath.Dir(projectDir)
+	}
+
+	result := &parse.ParseResult{
+		Meta: parse.SessionMeta{
+			SessionKey: sessionKey,
+			Source:     "gemini",
+			FilePath:   filePath,
+			RepoCwd:    readProjectRoot(projectDir),
+			Mtime:      info.ModTime(),
+			Size:       info.Size(),
+		},
+	}
+
+	b := &chunkBuilder{sessionKey: sessionKey}
+	if isChatFile(filePath) {
+		var rec chatRecord
+		if err := json.Unmarshal(data, &rec); err != nil {
+			return nil, err
+		}
+		parseChat(b, &rec)
+		result.Meta.Summary = strings.TrimSpace(rec.Summary)
+	} else {
+		var history []checkpointContent
+		if err := json.Unmarshal(data, &history); err != nil {
+			return nil, err
+		}
+		// checkpoints carry no timestamps; date everything at the save time
+		parseCheckpoint(b, history, info.ModTime().UTC())
+	}
+
+	result.Chunks = b.chunks
+	result.Meta.CreatedAt = b.firstTS
+	result.Meta.UpdatedAt = b.lastTS
+	if result.Meta.Summary == "" {
+		result.Meta.Summary = parse.Summarize(result.Chunks)
+	}
+	return result, nil
+}
+
+func parseChat(b *chunkBuilder, rec *chatRecord) {
+	for i, msg := range rec.Messages {
+		ts := parse.Timestamp(msg.Timestamp)
+		line := i + 1 // message index; JSON files have no meaningful line numbers
+
+		switch msg.Type {
+		case "user":
+			b.add(ts, line, "user", "text", "", contentText(msg.Content))
+		case "gemini":
+			for _, t := range msg.Thoughts {
+				b.add(ts, line, "assistant", "thinking", "", joinNonEmpty(": ", t.Subject, t.Description))
+			}
+			b.add(ts, line, "assistant", "text", "", contentText(msg.Content))
+			for _, tc := range msg.ToolCalls {
+				b.add(ts, line, "assistant", "tool_call", tc.Name, parse.FormatToolInput(tc.Args))
+				out := partsText(tc.Result)
+				if out == "" {
+					out = rawText(tc.ResultDisplay)
+				}
+				b.add(ts, line, "tool", "tool_result", tc.Name, out)
+			}
+		}
+	}
+}
+
+func parseCheckpoint(b *chunkBuilder, history []checkpointContent, ts time.Time) {
+	for i, c := range history {
+		line := i + 1
+		role := "assistant"
+		if c.Role == "user" {
+			role = "user"
+		}
+		var text, thinking []string
+		for _, p := range c.Parts {
+			switch {
+			case p.FunctionCall != nil:
+				b.add(ts, line, "assistant", "tool_call", p.FunctionCall.Name, parse.FormatToolInput(p.FunctionCall.Args))
+			case p.FunctionResponse != nil:
+				b.add(ts, line, "tool", "tool_result", p.FunctionResponse.Name, functionResponseText(p.FunctionResponse.Response))
+			case p.Thought:
+				thinking = append(thinking, p.Text)
+			case p.Text != "":
+				text = append(text, p.Text)
+			}
+		}
+		b.add(ts, line, role, "thinking", "", strings.Join(thinking, "\n"))
+		b.add(ts, line, role, "text", "", strings.Join(text, "\n"))
+	}
+}
+
+// chunkBuilder numbers chunks and tracks the session time span.
+type chunkBuilder struct {
+	sessionKey      string
+	chunks          []parse.Chunk
+	firstTS, lastTS time.Time
+}
+
+func (b *chunkBuilder) add(ts time.Time, line int, role, kind, tool, text string) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return
+	}
+	if b.firstTS.IsZero() {
+		b.firstTS = ts
+	}
+	if !ts.IsZero() {
+		b.lastTS = ts
+	}
+	b.chunks = append(b.chunks, parse.Chunk{
+		SessionKey: b.sessionKey,
+		ChunkID:    len(b.chunks),
+		Timestamp:  ts,
+		Role:       role,
+		Kind:       kind,
+		Tool:       tool,
+		Text:       text,
+		LineNumber: line,
+	})
+}
+
+// contentText flattens message content, which is either a string or a list of parts.
+func contentText(raw json.RawMessage) string {
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s
+	}
+	var parts []part
+	if err := json.Unmarshal(raw, &parts); err == nil {
+		return partsText(parts)
+	}
+	return ""
+}
+
+func partsText(parts []part) string {
+	var out []string
+	for _, p := range parts {
+		switch {
+		case p.FunctionResponse != nil:
+			out = append(out, functionResponseText(p.FunctionResponse.Response))
+		case p.Text != "" && !p.Thought:
+			out = append(out, p.Text)
+		}
+	}
+	return strings.Join(out, "\n")
+}
+
+// functionResponseText unwraps {"output": "..."} tool responses.
+func functionResponseText(raw json.RawMessage) string {
+	var resp struct {
+		Output string `json:"output"`
+		Error  string `json:"error"`
+	}
+	if err := json.Unmarshal(raw, &resp); err == nil && (resp.Output != "" || resp.Error != "") {
+		return joinNonEmpty("\n", resp.Output, resp.Error)
+	}
+	return rawText(raw)
+}
+
+// rawText returns a JSON string's value, or the raw JSON for other values.
+func rawText(raw json.RawMessage) string {
+	if len(raw) == 0 || string(raw) == "null" {
+		return ""
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s
+	}
+	return string(raw)
+}
+
+func joinNonEmpty(sep string, parts ...string) string {
+	var out []string
+	for _, p := range parts {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return strings.Join(out, sep)
+}
+
+// readProjectRoot returns the working directory recorded for a project
+// directory. Only newer Gemini CLI versions store it; older project
+// directories are keyed by an irreversible hash and yield "".
+func readProjectRoot(projectDir string) string {
+	data, err := os.ReadFile(filepath.Join(projectDir, ".project_root"))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
@@ -0,0 +1,87 @@
+package source
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/Zuo-Peng/ai-session-search/internal/config"
+	"github.com/Zuo-Peng/ai-session-search/internal/parse"
+)
+
+// Source describes one agent's log format: where its logs live, which files
+// belong to it, how to parse them and how to resume a session. Each format
+// lives in its own package under internal/source and registers itself from
+// an init function.
+type Source interface {
+	// Name is the identifier stored in sessions.source and accepted by --source.
+	Name() string
+
+	// Roots returns the directories to scan for this source's logs.
+	Roots(cfg *config.Config) []string
+
+	// Match reports whether a path found under a root belongs to this
+	// source. For directories, returning false prunes the walk.
+	Match(path string, info os.FileInfo) bool
+
+	// Parse reads one log file. root is the root the file was found under.
+	Parse(path, root string) (*parse.ParseResult, error)
+
+	// ResumeCommand returns the shell command that resumes the session
+	// stored in filePath, without the leading cd.
+	ResumeCommand(filePath string) string
+
+	// Color is the ANSI 256-color code used to display the source name.
+	Color() string
+}
+
+// Appender is implemented by sources whose logs only ever grow by whole
+// lines. ParseFrom parses just the lines after cur; the result holds only the
+// new chunks, metadata seen in those lines, and the new cursor. Its Summary is
+// set only when the tail itself names one, so the caller can keep the old one.
+type Appender interface {
+	ParseFrom(path, root string, cur parse.Cursor) (*parse.ParseResult, error)
+}
+
+// Scattered is implemented by sources whose roots are large trees with a few
+// logs somewhere inside, like aider's histories in each repository under
+// ~/code. A watcher watches only the directories holding their logs, since
+// watching every directory of such a tree can exhaust the inotify limit.
+type Scattered interface {
+	// ScatteredLogs only marks the source; it does nothing.
+	ScatteredLogs()
+}
+
+var (
+	registry = make(map[string]Source)
+	order    []string
+)
+
+// Register makes a source available by name. It panics if the name is
+// already registered.
+func Register(s Source) {
+	name := s.Name()
+	if _, dup := registry[name]; dup {
+		panic(fmt.Sprintf("source: Register called twice for %q", name))
+	}
+	registry[name] = s
+	order = append(order, name)
+}
+
+// Get returns the source registered under name, or nil.
+func Get(name string) Source {
+	return registry[name]
+}
+
+// All returns the registered sources in registration order.
+func All() []Source {
+	all := make([]Source, 0, len(order))
+	for _, name := range order {
+		all = append(all, registry[name])
+	}
+	return all
+}
+
+// Names returns the registered source names in registration order.
+func Names() []string {
+	return append([]string(nil), order...)
+}
@@ -11,6 +11,8 @@ type keyMap struct {
 	PreviewDn  key.Binding
 	PageUp     key.Binding
 	PageDown   key.Binding
+	Subagents  key.Binding
+	Subagent   key.Binding
 }
 
 var keys = keyMap{
@@ -46,4 +48,13 @@ var keys = keyMap{
 		key.WithKeys("pgdown"),
 		key.WithHelp("pgdn", "preview pgdn"),
 	),
+	// neither is bound by the filter input, unlike C-a (line start)
+	Subagents: key.NewBinding(
+		key.WithKeys("ctrl+t"),
+		key.WithHelp("C-t", "toggle subagents"),
+	),
+	Subagent: key.NewBinding(
+		key.WithKeys("ctrl+o"),
+		key.WithHelp("C-o", "open subagent"),
+	),
 }
@@ -50,15 +50,7 @@ func (m model) renderList(width, height int) string {
 //	line 2:    snippet (dimmed)
 func formatResultLine(r search.Result, width int, selected bool) []string {
 	// Format source with color
-	var src string
-	switch r.Source {
-	case "claude":
-		src = styleSourceClaude.Render("claude")
-	case "codex":
-		src = styleSourceCodex.Render("codex")
-	default:
-		src = r.Source
-	}
+	src := sourceStyle(r.Source).Render(r.Source)
 
 	// Extract short date from UpdatedAt (e.g. "2026-01-27" -> "01-27")
 	date := r.UpdatedAt
@@ -68,6 +60,12 @@ func formatResultLine(r search.Result, width int, selected bool) []string {
 
 	// Truncate summary to fit width: leave room for prefix "  src MM-DD "
 	summary := strings.ReplaceAll(r.Summary, "\n", " ")
+	if r.Archived {
+		summary = "[archived] " + summary
+	}
+	if r.ParentSessionKey != "" {
+		summary = "↳ " + summary
+	}
 	summaryMax := width - 2 - 7 - 6 - 2 // prefix + source + date + padding
 	if summaryMax < 0 {
 		summaryMax = 0
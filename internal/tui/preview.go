@@ -1,6 +1,8 @@
 package tui
 
 import (
+	"context"
+
 	"github.com/charmbracelet/bubbles/viewport"
 	"github.com/Zuo-Peng/ai-session-search/internal/index"
 	"github.com/Zuo-Peng/ai-session-search/internal/render"
@@ -14,25 +16,37 @@ type previewRenderedMsg struct {
 	chunkID    int
 	content    string
 	hitLine    int
+	subagents  []string // keys of the session's subagents
 	err        error
 }
 
-// loadPreviewCmd returns a tea.Cmd that renders the conversation preview async.
-func loadPreviewCmd(db *index.DB, r search.Result, query string, width int) tea.Cmd {
+// loadPreviewCmd returns a tea.Cmd that renders the conversation preview
+// async. Cancelling ctx abandons the render.
+func loadPreviewCmd(ctx context.Context, db *index.DB, r search.Result, query string, width int) tea.Cmd {
 	return func() tea.Msg {
-		content, hitLine, err := render.RenderConversation(db, r.SessionKey, render.Options{
+		content, hitLine, err := render.RenderConversation(ctx, db, r.SessionKey, render.Options{
 			HitChunkID: r.ChunkID,
 			Context:    -1,
 			Width:      width,
 			Query:      query,
 		})
-		return previewRenderedMsg{
+		msg := previewRenderedMsg{
 			sessionKey: r.SessionKey,
 			chunkID:    r.ChunkID,
 			content:    content,
 			hitLine:    hitLine,
 			err:        err,
 		}
+		if err == nil {
+			subagents, err := db.GetSubagents(r.SessionKey)
+			if err != nil {
+				msg.err = err
+			}
+			for _, sa := range subagents {
+				msg.subagents = append(msg.subagents, sa.SessionKey)
+			}
+		}
+		return msg
 	}
 }
 
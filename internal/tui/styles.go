@@ -1,6 +1,9 @@
 package tui
 
-import "github.com/charmbracelet/lipgloss"
+import (
+	"github.com/charmbracelet/lipgloss"
+	"github.com/Zuo-Peng/ai-session-search/internal/source"
+)
 
 var (
 	// Colors
@@ -30,12 +33,6 @@ var (
 	styleListSource = lipgloss.NewStyle().
 			Width(7)
 
-	styleSourceClaude = lipgloss.NewStyle().
-				Foreground(colorPrimary)
-
-	styleSourceCodex = lipgloss.NewStyle().
-			Foreground(colorSecondary)
-
 	// Panels
 	stylePanelBorder = lipgloss.NewStyle().
 				Border(lipgloss.RoundedBorder()).
@@ -55,3 +52,11 @@ var (
 			Foreground(colorDim).
 			Bold(true)
 )
+
+// sourceStyle colors a source name with the color its source registered.
+func sourceStyle(name string) lipgloss.Style {
+	if src := source.Get(name); src != nil {
+		return lipgloss.NewStyle().Foreground(lipgloss.Color(src.Color()))
+	}
+	return lipgloss.NewStyle()
+}
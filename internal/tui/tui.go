@@ -1,9 +1,11 @@
 package tui
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"os"
 	"path/filepath"
-	"regexp"
 	"strings"
 	"time"
 
@@ -15,9 +17,16 @@ import (
 	"github.com/charmbracelet/lipgloss"
 	"github.com/Zuo-Peng/ai-session-search/internal/index"
 	"github.com/Zuo-Peng/ai-session-search/internal/search"
+	"github.com/Zuo-Peng/ai-session-search/internal/source"
 )
 
-const debounceDelay = 200 * time.Millisecond
+const (
+	debounceDelay = 200 * time.Millisecond
+
+	// indexProgressInterval limits how often background indexing redraws
+	// the status bar.
+	indexProgressInterval = 100 * time.Millisecond
+)
 
 type tuiMode int
 
@@ -32,12 +41,62 @@ type searchResultMsg struct {
 	query   string
 	results []search.Result
 	err     error
+	refresh bool // re-run after indexing; keep the selection
 }
 
 type debounceTickMsg struct {
 	query string
 }
 
+type indexProgressMsg struct {
+	done, total int
+}
+
+type indexDoneMsg struct {
+	stats index.Stats
+	err   error
+}
+
+// inflight cancels the search and preview render running in the background
+// when newer ones supersede them. Bubble Tea copies the model on every
+// update, so the model shares it through a pointer.
+type inflight struct {
+	search  context.CancelFunc
+	preview context.CancelFunc
+}
+
+// nextSearch cancels the search in flight and returns the context for the
+// one replacing it.
+func (f *inflight) nextSearch() context.Context {
+	return replace(&f.search)
+}
+
+// nextPreview is nextSearch for preview renders.
+func (f *inflight) nextPreview() context.Context {
+	return replace(&f.preview)
+}
+
+// cancelSearch cancels the search in flight, whose query is out of date.
+func (f *inflight) cancelSearch() {
+	if f.search != nil {
+		f.search()
+		f.search = nil
+	}
+}
+
+func replace(cancel *context.CancelFunc) context.Context {
+	if *cancel != nil {
+		(*cancel)()
+	}
+	ctx, c := context.WithCancel(context.Background())
+	*cancel = c
+	return ctx
+}
+
+// IndexFunc updates the index, reporting to progress. The TUI runs it in the
+// background so that it is usable on the current index straight away.
+type IndexFunc func(progress index.Progress) (index.Stats, error)
+
 // model
 
 type model struct {
@@ -56,6 +115,21 @@ type model struct {
 	ready       bool
 	quitting    bool
 	openResult *search.Result
+	inflight    *inflight
+	searchErr   error // of the last search, e.g. a query that does not parse
+
+	// subagents listed in the preview of the selected session; the preview
+	// shows subagents[subagent] instead of the session while it is >= 0
+	subagents   []string
+	subagentsOf string
+	subagent    int
+
+	// background index pass
+	indexing   bool
+	indexDone  int
+	indexTotal int
+	indexed    index.Stats
+	indexErr   error
 }
 
 func initialModel(db *index.DB, query string, opts search.Options) model {
@@ -74,28 +148,21 @@ func initialModel(db *index.DB, query string, opts search.Options) model {
 		query:       query,
 		filterInput: ti,
 		preview:     viewport.New(0, 0),
+		inflight:    &inflight{},
+		subagent:    -1,
 	}
 }
 
 // Run starts the TUI and blocks until it exits.
 // If the user selects a result, it copies the session ID to clipboard.
-func Run(db *index.DB, query string, opts search.Options) error {
-	m := initialModel(db, query, opts)
-	p := tea.NewProgram(m, tea.WithAltScreen(), tea.WithMouseCellMotion())
-	finalModel, err := p.Run()
-	if err != nil {
-		return fmt.Errorf("tui: %w", err)
-	}
-
-	fm := finalModel.(model)
-	if fm.openResult != nil {
-		return copySessionID(db, fm.openResult.SessionKey, fm.openResult.Source)
-	}
-	return nil
+// reindex, if not nil, runs in the background and the results are refreshed
+// when it has changed the index.
+func Run(db *index.DB, query string, opts search.Options, reindex IndexFunc) error {
+	return run(initialModel(db, query, opts), reindex)
 }
 
 // RunList starts the TUI in list mode, showing all sessions sorted by update time.
-func RunList(db *index.DB, opts search.Options) error {
+func RunList(db *index.DB, opts search.Options, reindex IndexFunc) error {
 	ti := textinput.New()
 	ti.Placeholder = "Filter..."
 	ti.Focus()
@@ -110,22 +177,64 @@ func RunList(db *index.DB, opts search.Options) error {
 		mode:        modeList,
 		filterInput: ti,
 		preview:     viewport.New(0, 0),
+		inflight:    &inflight{},
+		subagent:    -1,
 	}
+	return run(m, reindex)
+}
+
+// run runs the program, with reindex in the background. An index pass still
+// going when the user quits is finished first, so it is not cut off halfway.
+func run(m model, reindex IndexFunc) error {
+	m.indexing = reindex != nil
 	p := tea.NewProgram(m, tea.WithAltScreen(), tea.WithMouseCellMotion())
+
+	var indexed chan struct{}
+	if reindex != nil {
+		indexed = make(chan struct{})
+		go func() {
+			defer close(indexed)
+			stats, err := reindex(sendProgress(p))
+			p.Send(indexDoneMsg{stats: stats, err: err})
+		}()
+	}
+
 	finalModel, err := p.Run()
-	if err != nil {
-		return fmt.Errorf("tui: %w", err)
+	if err == nil {
+		if fm := finalModel.(model); fm.openResult != nil {
+			err = copySessionID(m.db, fm.openResult.SessionKey)
+		}
+	} else {
+		err = fmt.Errorf("tui: %w", err)
 	}
 
-	fm := finalModel.(model)
-	if fm.openResult != nil {
-		return copySessionID(db, fm.openResult.SessionKey, fm.openResult.Source)
+	if indexed != nil {
+		select {
+		case <-indexed:
+		default:
+			fmt.Fprintln(os.Stderr, "Finishing the index update...")
+			<-indexed
+		}
 	}
-	return nil
+	return err
 }
 
-// copySessionID extracts the resume session ID from the DB and copies it to clipboard.
-func copySessionID(db *index.DB, sessionKey, source string) error {
+// sendProgress forwards the progress of an index pass to the program, at
+// most every indexProgressInterval.
+func sendProgress(p *tea.Program) index.Progress {
+	var last time.Time
+	return func(ev index.Event) {
+		if ev.Done < ev.Total && time.Since(last) < indexProgressInterval {
+			return
+		}
+		last = time.Now()
+		p.Send(indexProgressMsg{done: ev.Done, total: ev.Total})
+	}
+}
+
+// copySessionID builds the resume command for a session via its source and
+// copies it to clipboard.
+func copySessionID(db *index.DB, sessionKey string) error {
 	session, err := db.GetSessionByKey(sessionKey)
 	if err != nil {
 		return fmt.Errorf("get session: %w", err)
@@ -134,20 +243,25 @@ func copySessionID(db *index.DB, sessionKey, source string) error {
 		return fmt.Errorf("session not found: %s", sessionKey)
 	}
 
-	// Extract session ID from file name (without .jsonl extension)
-	sessionID := strings.TrimSuffix(filepath.Base(session.FilePath), ".jsonl")
+	// Subagent transcripts cannot be resumed on their own; resume the parent
+	if session.ParentSessionKey != "" {
+		parent, err := db.GetSessionByKey(session.ParentSessionKey)
+		if err != nil {
+			return fmt.Errorf("get parent session: %w", err)
+		}
+		if parent != nil {
+			session = parent
+		}
+	}
+	if session.Archived {
+		return fmt.Errorf("session %s is archived: %s was deleted, so it cannot be resumed", session.SessionKey, session.FilePath)
+	}
 
 	var resumeCmd string
-	switch source {
-	case "claude":
-		resumeCmd = fmt.Sprintf("claude --resume %s", sessionID)
-	case "codex":
-		// Codex expects UUID only, extract from filename like
-		// rollout-2026-01-26T17-30-22-019bf9a3-d433-7fc1-8214-b82613804964
-		codexID := extractUUID(sessionID)
-		resumeCmd = fmt.Sprintf("codex resume %s", codexID)
-	default:
-		resumeCmd = sessionID
+	if src := source.Get(session.Source); src != nil {
+		resumeCmd = src.ResumeCommand(session.FilePath)
+	} else {
+		resumeCmd = strings.TrimSuffix(filepath.Base(session.FilePath), filepath.Ext(session.FilePath))
 	}
 
 	// Prepend cd if the session has a working directory
@@ -167,17 +281,6 @@ func copySessionID(db *index.DB, sessionKey, source string) error {
 	return nil
 }
 
-// uuidRe matches a standard UUID (8-4-4-4-12 hex pattern).
-var uuidRe = regexp.MustCompile(`[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}`)
-
-// extractUUID extracts a UUID from a string, returning the original if none found.
-func extractUUID(s string) string {
-	if m := uuidRe.FindString(s); m != "" {
-		return m
-	}
-	return s
-}
-
 // Init triggers the initial search/list load.
 func (m model) Init() tea.Cmd {
 	cmds := []tea.Cmd{textinput.Blink}
@@ -201,8 +304,8 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.ready = true
 		m.preview = newViewport(m.previewWidth(), m.panelHeight())
 		// Re-render preview if we have a selection
-		if len(m.results) > 0 && m.cursor < len(m.results) {
-			cmds = append(cmds, loadPreviewCmd(m.db, m.results[m.cursor], m.query, m.previewWidth()))
+		if r, ok := m.previewTarget(); ok {
+			cmds = append(cmds, loadPreviewCmd(m.inflight.nextPreview(), m.db, r, m.query, m.previewWidth()))
 		}
 		return m, tea.Batch(cmds...)
 
@@ -215,6 +318,10 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		case key.Matches(msg, keys.Enter):
 			if len(m.results) > 0 && m.cursor < len(m.results) {
 				r := m.results[m.cursor]
+				if r.Archived {
+					// the log is gone, so there is nothing to resume
+					return m, nil
+				}
 				m.openResult = &r
 				m.quitting = true
 				return m, tea.Quit
@@ -251,6 +358,26 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		case key.Matches(msg, keys.PageDown):
 			m.preview.LineDown(m.panelHeight())
 			return m, nil
+
+		case key.Matches(msg, keys.Subagent):
+			// step through the subagents listed in the preview, then back
+			if m.hasSubagents() {
+				m.subagent++
+				if m.subagent == len(m.subagents) {
+					m.subagent = -1
+				}
+				cmds = append(cmds, m.loadPreview())
+			}
+			return m, tea.Batch(cmds...)
+
+		case key.Matches(msg, keys.Subagents):
+			m.searchOpts.IncludeSubagents = !m.searchOpts.IncludeSubagents
+			if m.mode == modeList {
+				cmds = append(cmds, m.doListAll(m.query))
+			} else {
+				cmds = append(cmds, m.doSearch(m.query))
+			}
+			return m, tea.Batch(cmds...)
 		}
 
 		// Pass remaining keys to text input
@@ -262,6 +389,7 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		newQuery := m.filterInput.Value()
 		if newQuery != m.query {
 			m.query = newQuery
+			m.inflight.cancelSearch()
 			cmds = append(cmds, m.scheduleDebouncedSearch(newQuery))
 		}
 		return m, tea.Batch(cmds...)
@@ -322,11 +450,24 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 		return m, tea.Batch(cmds...)
 
+	case indexProgressMsg:
+		m.indexDone, m.indexTotal = msg.done, msg.total
+		return m, nil
+
+	case indexDoneMsg:
+		m.indexing = false
+		m.indexed, m.indexErr = msg.stats, msg.err
+		if msg.stats.Updated+msg.stats.Pruned+msg.stats.Archived > 0 {
+			return m, m.refresh()
+		}
+		return m, nil
+
 	case searchResultMsg:
 		// Only apply if this result matches current query
-		if msg.query != m.query {
+		if msg.query != m.query || errors.Is(msg.err, context.Canceled) {
 			return m, nil
 		}
+		m.searchErr = msg.err
 		if msg.err != nil {
 			// On error, clear results
 			m.results = nil
@@ -336,9 +477,23 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			m.previewKey = ""
 			return m, nil
 		}
+		var selected *search.Result
+		if msg.refresh && m.cursor < len(m.results) {
+			selected = &m.results[m.cursor]
+		}
 		m.results = msg.results
 		m.cursor = 0
 		m.listOffset = 0
+		if selected != nil {
+			// stay on the same hit if it is still there
+			for i, r := range m.results {
+				if r.SessionKey == selected.SessionKey && r.ChunkID == selected.ChunkID {
+					m.cursor = i
+					m.adjustListScroll(m.panelHeight())
+					break
+				}
+			}
+		}
 		if len(m.results) > 0 {
 			cmds = append(cmds, m.loadCurrentPreview())
 		} else {
@@ -348,18 +503,23 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		return m, tea.Batch(cmds...)
 
 	case previewRenderedMsg:
+		if errors.Is(msg.err, context.Canceled) {
+			return m, nil // superseded by another preview
+		}
 		key := previewCacheKey(msg.sessionKey, msg.chunkID)
 		if key == m.previewKey {
 			// Already showing this preview, skip
 			return m, nil
 		}
 		// Check if this preview is still the one we want
-		if len(m.results) > 0 && m.cursor < len(m.results) {
-			r := m.results[m.cursor]
+		if r, ok := m.previewTarget(); ok {
 			wantKey := previewCacheKey(r.SessionKey, r.ChunkID)
 			if key != wantKey {
 				return m, nil // stale preview
 			}
+			if r.SessionKey == m.results[m.cursor].SessionKey {
+				m.subagents, m.subagentsOf = msg.subagents, r.SessionKey
+			}
 		}
 		if msg.err != nil {
 			m.preview.SetContent("Preview error: " + msg.err.Error())
@@ -491,23 +651,86 @@ func (m model) hitTest(x, y int) (mouseRegion, int) {
 func (m model) statusBar() string {
 	count := len(m.results)
 	var parts []string
-	parts = append(parts, fmt.Sprintf("%d results", count))
+	if m.searchErr != nil {
+		parts = append(parts, m.searchErr.Error())
+	} else {
+		parts = append(parts, fmt.Sprintf("%d results", count))
+	}
+	if s := m.indexStatus(); s != "" {
+		parts = append(parts, s)
+	}
 	parts = append(parts, "click/up/dn navigate")
 	parts = append(parts, "scroll/C-u/C-d preview")
-	parts = append(parts, "Enter copy resume cmd")
+	if m.searchOpts.IncludeSubagents {
+		parts = append(parts, "C-t hide subagents")
+	} else {
+		parts = append(parts, "C-t show subagents")
+	}
+	if m.hasSubagents() {
+		switch {
+		case m.subagent < 0:
+			parts = append(parts, "C-o open subagent")
+		case m.subagent == len(m.subagents)-1:
+			parts = append(parts, fmt.Sprintf("subagent %d/%d, C-o back", m.subagent+1, len(m.subagents)))
+		default:
+			parts = append(parts, fmt.Sprintf("subagent %d/%d, C-o next", m.subagent+1, len(m.subagents)))
+		}
+	}
+	if m.cursor < count && m.results[m.cursor].Archived {
+		parts = append(parts, "archived: cannot resume")
+	} else {
+		parts = append(parts, "Enter copy resume cmd")
+	}
 	parts = append(parts, "Esc quit")
 	return styleStatusBar.Render(strings.Join(parts, " | "))
 }
 
+// indexStatus describes the background index pass for the status bar.
+func (m model) indexStatus() string {
+	var locked *index.LockedError
+	switch {
+	case m.indexing && m.indexTotal > 0:
+		return fmt.Sprintf("indexing %d/%d", m.indexDone, m.indexTotal)
+	case m.indexing:
+		return "indexing"
+	case errors.As(m.indexErr, &locked):
+		return "another ais is indexing"
+	case m.indexErr != nil:
+		return "index: " + m.indexErr.Error()
+	case m.indexed.Errors > 0:
+		return fmt.Sprintf("%d files failed to index (run ais index)", m.indexed.Errors)
+	}
+	return ""
+}
+
+// refresh re-runs the current query or listing after the index changed.
+func (m model) refresh() tea.Cmd {
+	var cmd tea.Cmd
+	switch {
+	case m.mode == modeList:
+		cmd = m.doListAll(m.query)
+	case m.query != "":
+		cmd = m.doSearch(m.query)
+	default:
+		return nil
+	}
+	return func() tea.Msg {
+		msg := cmd().(searchResultMsg)
+		msg.refresh = true
+		return msg
+	}
+}
+
 func (m model) doSearch(query string) tea.Cmd {
 	db := m.db
 	opts := m.searchOpts
 	opts.Query = query
+	ctx := m.inflight.nextSearch()
 	return func() tea.Msg {
 		if query == "" {
 			return searchResultMsg{query: query}
 		}
-		results, err := search.Search(db, opts)
+		results, err := search.Search(ctx, db, opts)
 		return searchResultMsg{query: query, results: results, err: err}
 	}
 }
@@ -516,13 +739,14 @@ func (m model) doListAll(filter string) tea.Cmd {
 	db := m.db
 	opts := m.searchOpts
 	opts.Query = filter
+	ctx := m.inflight.nextSearch()
 	return func() tea.Msg {
 		if filter == "" {
-			results, err := search.ListAll(db, opts)
+			results, err := search.ListAll(ctx, db, opts)
 			return searchResultMsg{query: filter, results: results, err: err}
 		}
 		// When there's input, do full-text search across all conversation content
-		results, err := search.Search(db, opts)
+		results, err := search.Search(ctx, db, opts)
 		return searchResultMsg{query: filter, results: results, err: err}
 	}
 }
@@ -533,16 +757,42 @@ func (m model) scheduleDebouncedSearch(query string) tea.Cmd {
 	})
 }
 
-func (m model) loadCurrentPreview() tea.Cmd {
-	if len(m.results) == 0 || m.cursor >= len(m.results) {
+// loadCurrentPreview shows the selected result, after the selection changed.
+func (m *model) loadCurrentPreview() tea.Cmd {
+	m.subagent = -1
+	return m.loadPreview()
+}
+
+// loadPreview renders the preview target unless it is already shown.
+func (m model) loadPreview() tea.Cmd {
+	r, ok := m.previewTarget()
+	if !ok {
 		return nil
 	}
-	r := m.results[m.cursor]
 	key := previewCacheKey(r.SessionKey, r.ChunkID)
 	if key == m.previewKey {
 		return nil // already showing this preview
 	}
-	return loadPreviewCmd(m.db, r, m.query, m.previewWidth())
+	return loadPreviewCmd(m.inflight.nextPreview(), m.db, r, m.query, m.previewWidth())
+}
+
+// previewTarget is what the preview shows: the selected result, or the
+// subagent of it opened with keys.Subagent.
+func (m model) previewTarget() (search.Result, bool) {
+	if len(m.results) == 0 || m.cursor >= len(m.results) {
+		return search.Result{}, false
+	}
+	r := m.results[m.cursor]
+	if m.subagent >= 0 && m.hasSubagents() {
+		return search.Result{SessionKey: m.subagents[m.subagent], ChunkID: -1}, true
+	}
+	return r, true
+}
+
+// hasSubagents reports whether the preview lists subagents of the selected
+// result.
+func (m model) hasSubagents() bool {
+	return len(m.subagents) > 0 && m.cursor < len(m.results) && m.results[m.cursor].SessionKey == m.subagentsOf
 }
 
 func previewCacheKey(sessionKey string, chunkID int) string {
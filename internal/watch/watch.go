@@ -0,0 +1,87 @@
+// Package watch keeps the index current by re-indexing log files as agents
+// write them.
+package watch
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Zuo-Peng/ai-session-search/internal/config"
+	"github.com/Zuo-Peng/ai-session-search/internal/index"
+)
+
+// flushDelay is how long changes are collected before they are indexed, so a
+// burst of writes to a live log is indexed once.
+const flushDelay = 250 * time.Millisecond
+
+// retryDelay is how long changes whose index pass failed wait before they
+// are indexed again.
+const retryDelay = 10 * time.Second
+
+// Run indexes everything once, then watches the roots of every source and
+// re-indexes changed files until ctx is cancelled. While it runs it keeps a
+// heartbeat in the index so that search and list can skip their own scan.
+// logf receives progress messages.
+func Run(ctx context.Context, db *index.DB, cfg *config.Config, logf func(format string, args ...any)) error {
+	return run(ctx, db, cfg, logf)
+}
+
+// logStats reports an index pass unless it found nothing to do.
+func logStats(logf func(format string, args ...any), stats index.Stats) {
+	if stats.Updated > 0 || stats.Pruned > 0 || stats.Archived > 0 || stats.Errors > 0 {
+		logf("indexed: %s", stats)
+	}
+}
+
+// logWarnings logs the files an index pass fails on.
+func logWarnings(logf func(format string, args ...any)) index.Progress {
+	return func(ev index.Event) {
+		if ev.Kind == index.EventError {
+			logf("warn: %v", ev)
+		}
+	}
+}
+
+// keepHeartbeat refreshes the watcher heartbeat every HeartbeatInterval, also
+// while a long index pass runs, until ctx is cancelled or stop is called.
+// stop returns once the heartbeat is no longer written.
+func keepHeartbeat(ctx context.Context, db *index.DB, logf func(format string, args ...any)) (stop func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		t := time.NewTicker(index.HeartbeatInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+				if err := db.SetWatcherHeartbeat(); err != nil {
+					logf("heartbeat: %v", err)
+				}
+			}
+		}
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// withIndexLock runs an index pass under the index lock, first waiting for
+// any other process that is indexing until ctx is cancelled.
+func withIndexLock(ctx context.Context, db *index.DB, logf func(format string, args ...any), pass func() (index.Stats, error)) (index.Stats, error) {
+	release, err := db.LockIndex(false)
+	var locked *index.LockedError
+	if errors.As(err, &locked) {
+		logf("waiting: %v", locked)
+		release, err = db.LockIndexContext(ctx)
+	}
+	if err != nil {
+		return index.Stats{}, err
+	}
+	defer release()
+	return pass()
+}
@@ -0,0 +1,332 @@
+//go:build linux
+
+package watch
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+	"unsafe"
+
+	"github.com/Zuo-Peng/ai-session-search/internal/config"
+	"github.com/Zuo-Peng/ai-session-search/internal/index"
+	"github.com/Zuo-Peng/ai-session-search/internal/source"
+	"golang.org/x/sys/unix"
+)
+
+const watchMask = unix.IN_CREATE | unix.IN_MODIFY | unix.IN_CLOSE_WRITE |
+	unix.IN_MOVED_TO | unix.IN_MOVED_FROM | unix.IN_DELETE
+
+// rescanInterval is how often the trees of scattered sources are searched
+// for logs in directories that are not watched yet.
+const rescanInterval = time.Minute
+
+// watchedDir is a directory under inotify watch and the sources whose walk
+// reaches it.
+type watchedDir struct {
+	path string
+	srcs []source.Source
+}
+
+// root is a root directory of a source.
+type root struct {
+	src  source.Source
+	path string
+}
+
+type watcher struct {
+	fd   int
+	logf func(format string, args ...any)
+	dirs map[int]*watchedDir // by watch descriptor
+
+	missing   []root // roots that did not exist yet
+	scattered []root // roots of source.Scattered sources, searched again
+	lastScan  time.Time
+
+	pending      map[string]bool // changed file paths
+	rescan       bool            // events were lost; run a full index
+	firstPending time.Time
+}
+
+func run(ctx context.Context, db *index.DB, cfg *config.Config, logf func(format string, args ...any)) error {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return fmt.Errorf("inotify: %w", err)
+	}
+	defer unix.Close(fd)
+
+	w := &watcher{
+		fd:      fd,
+		logf:    logf,
+		dirs:    make(map[int]*watchedDir),
+		pending: make(map[string]bool),
+	}
+
+	// watch before the initial index so no write falls in between
+	for _, hc := range cfg.HostConfigs() {
+		for _, src := range source.All() {
+			for _, path := range src.Roots(hc) {
+				if path == "" {
+					continue
+				}
+				r := root{src: src, path: path}
+				if _, err := os.Stat(path); err != nil {
+					logf("%s root %s: %v; watching for it", src.Name(), path, err)
+					w.missing = append(w.missing, r)
+					continue
+				}
+				w.addRoot(r)
+			}
+		}
+	}
+	w.lastScan = time.Now()
+	logf("watching %d directories", len(w.dirs))
+
+	progress := logWarnings(logf)
+
+	stats, err := withIndexLock(ctx, db, logf, func() (index.Stats, error) {
+		return index.IndexAll(db, cfg, progress)
+	})
+	if ctx.Err() != nil {
+		return nil // stopped while waiting for the lock
+	}
+	if err != nil {
+		return fmt.Errorf("index: %w", err)
+	}
+	logf("initial index: %s", stats)
+	w.pending = make(map[string]bool)
+
+	if err := db.SetWatcherHeartbeat(); err != nil {
+		return fmt.Errorf("heartbeat: %w", err)
+	}
+	defer db.ClearWatcherHeartbeat()
+	defer keepHeartbeat(ctx, db, logf)()
+	lastCheck := time.Now()
+
+	buf := make([]byte, 64*1024)
+	for {
+		if ctx.Err() != nil {
+			return nil
+		}
+		if time.Since(lastCheck) >= index.HeartbeatInterval {
+			lastCheck = time.Now()
+			w.checkRoots()
+		}
+
+		// wake up in time to flush pending changes, and regularly to notice
+		// cancellation
+		timeout := flushDelay
+		if w.hasPending() {
+			timeout = min(max(flushDelay-time.Since(w.firstPending), 0), flushDelay)
+		}
+		fds := []unix.PollFd{{Fd: int32(fd), Events: unix.POLLIN}}
+		n, err := unix.Poll(fds, int(timeout/time.Millisecond))
+		if err != nil && err != unix.EINTR {
+			return fmt.Errorf("poll: %w", err)
+		}
+		if n > 0 {
+			if err := w.read(buf); err != nil {
+				return err
+			}
+		}
+
+		if !w.hasPending() || time.Since(w.firstPending) < flushDelay {
+			continue
+		}
+		rescan := w.rescan
+		paths := make([]string, 0, len(w.pending))
+		for p := range w.pending {
+			paths = append(paths, p)
+		}
+		stats, err = withIndexLock(ctx, db, logf, func() (index.Stats, error) {
+			if rescan {
+				return index.IndexAll(db, cfg, progress)
+			}
+			return index.IndexFiles(db, cfg, paths, progress)
+		})
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			// keep the changes pending and try again later
+			logf("index: %v; retrying in %v", err, retryDelay)
+			w.firstPending = time.Now().Add(retryDelay)
+			continue
+		}
+		w.pending = make(map[string]bool)
+		w.rescan = false
+		logStats(logf, stats)
+	}
+}
+
+func (w *watcher) hasPending() bool {
+	return w.rescan || len(w.pending) > 0
+}
+
+func (w *watcher) markPending(path string) {
+	if !w.hasPending() {
+		w.firstPending = time.Now()
+	}
+	w.pending[path] = true
+}
+
+func (w *watcher) markRescan() {
+	if !w.hasPending() {
+		w.firstPending = time.Now()
+	}
+	w.rescan = true
+}
+
+func (w *watcher) addRoot(r root) {
+	if _, ok := r.src.(source.Scattered); ok {
+		w.scattered = append(w.scattered, r)
+	}
+	w.addTree(r.src, r.path)
+}
+
+// checkRoots watches the missing roots that have been created since, and
+// every rescanInterval searches the scattered roots for new logs.
+func (w *watcher) checkRoots() {
+	missing := w.missing[:0]
+	for _, r := range w.missing {
+		if _, err := os.Stat(r.path); err != nil {
+			missing = append(missing, r)
+			continue
+		}
+		w.logf("%s root %s created; watching it", r.src.Name(), r.path)
+		w.addRoot(r)
+	}
+	w.missing = missing
+
+	if time.Since(w.lastScan) < rescanInterval {
+		return
+	}
+	w.lastScan = time.Now()
+	for _, r := range w.scattered {
+		w.addTree(r.src, r.path)
+	}
+}
+
+// addTree watches dir and every subdirectory src does not prune, or for a
+// source.Scattered only the directories holding its logs. Files in newly
+// watched directories are queued, since they may have been written before
+// the watch was in place.
+func (w *watcher) addTree(src source.Source, dir string) {
+	_, scattered := src.(source.Scattered)
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil // skip unreadable dirs
+		}
+		if !info.IsDir() {
+			if !src.Match(path, info) {
+				return nil
+			}
+			if !scattered || w.addWatch(src, filepath.Dir(path)) {
+				w.markPending(path)
+			}
+			return nil
+		}
+		if path != dir && !src.Match(path, info) {
+			return filepath.SkipDir
+		}
+		if !scattered {
+			w.addWatch(src, path)
+		}
+		return nil
+	})
+}
+
+// addWatch watches dir for src and reports whether it was not already.
+func (w *watcher) addWatch(src source.Source, dir string) bool {
+	wd, err := unix.InotifyAddWatch(w.fd, dir, watchMask)
+	if err != nil {
+		w.logf("watch %s: %v", dir, err)
+		return false
+	}
+	d := w.dirs[wd]
+	if d == nil {
+		d = &watchedDir{path: dir}
+		w.dirs[wd] = d
+	}
+	for _, s := range d.srcs {
+		if s == src {
+			return false
+		}
+	}
+	d.srcs = append(d.srcs, src)
+	return true
+}
+
+// read drains the inotify queue into pending changes.
+func (w *watcher) read(buf []byte) error {
+	for {
+		n, err := unix.Read(w.fd, buf)
+		if err == unix.EAGAIN || err == unix.EINTR {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("read inotify: %w", err)
+		}
+		if n <= 0 {
+			return nil
+		}
+
+		for off := 0; off+unix.SizeofInotifyEvent <= n; {
+			ev := (*unix.InotifyEvent)(unsafe.Pointer(&buf[off]))
+			nameBytes := buf[off+unix.SizeofInotifyEvent : off+unix.SizeofInotifyEvent+int(ev.Len)]
+			off += unix.SizeofInotifyEvent + int(ev.Len)
+			w.handle(ev, cString(nameBytes))
+		}
+	}
+}
+
+func (w *watcher) handle(ev *unix.InotifyEvent, name string) {
+	if ev.Mask&unix.IN_Q_OVERFLOW != 0 {
+		w.markRescan()
+		return
+	}
+	d := w.dirs[int(ev.Wd)]
+	if d == nil {
+		return
+	}
+	if ev.Mask&unix.IN_IGNORED != 0 {
+		delete(w.dirs, int(ev.Wd)) // directory removed
+		return
+	}
+	if name == "" {
+		return
+	}
+	path := filepath.Join(d.path, name)
+
+	if ev.Mask&unix.IN_ISDIR == 0 {
+		w.markPending(path)
+		return
+	}
+	switch {
+	case ev.Mask&(unix.IN_CREATE|unix.IN_MOVED_TO) != 0:
+		info, err := os.Stat(path)
+		if err != nil {
+			return
+		}
+		for _, src := range d.srcs {
+			if src.Match(path, info) {
+				w.addTree(src, path)
+			}
+		}
+	case ev.Mask&(unix.IN_DELETE|unix.IN_MOVED_FROM) != 0:
+		// sessions under the directory are gone; only a full pass prunes them
+		w.markRescan()
+	}
+}
+
+// cString returns the NUL-padded name that follows an inotify event.
+func cString(b []byte) string {
+	for i, c := range b {
+		if c == 0 {
+			return string(b[:i])
+		}
+	}
+	return string(b)
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+
+package watch
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Zuo-Peng/ai-session-search/internal/config"
+	"github.com/Zuo-Peng/ai-session-search/internal/index"
+)
+
+func run(ctx context.Context, db *index.DB, cfg *config.Config, logf func(format string, args ...any)) error {
+	return errors.New("ais watch needs inotify and is only supported on Linux")
+}